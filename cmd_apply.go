@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	registerCommand("apply", commandApply)
+}
+
+// channelStateFile declares the desired channels per network name or
+// UUID
+type channelStateFile struct {
+	Networks map[string][]desiredChannel `yaml:"networks"`
+}
+
+// desiredChannel is given either as name only or with its key and
+// topic
+type desiredChannel struct {
+	Name  string `yaml:"name"`
+	Key   string `yaml:"key"`
+	Topic string `yaml:"topic"`
+}
+
+func (d *desiredChannel) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&d.Name); err == nil {
+		return nil
+	}
+
+	type plain desiredChannel
+	return unmarshal((*plain)(d))
+}
+
+func commandApply(args []string) error {
+	if cfg.File == "" {
+		return usageErrorf("No channel state file given, use -f <file>")
+	}
+
+	raw, err := ioutil.ReadFile(cfg.File)
+	if err != nil {
+		return errors.Wrap(err, "Unable to read channel state file")
+	}
+
+	var desired channelStateFile
+	if err = yaml.UnmarshalStrict(raw, &desired); err != nil {
+		return usageError{errors.Wrap(err, "Unable to parse channel state file")}
+	}
+
+	for n, channels := range desired.Networks {
+		for _, c := range channels {
+			if c.Name == "" {
+				return usageErrorf("Channel without name given for network %q", n)
+			}
+		}
+	}
+
+	registerMembershipChange("apply", func(init initMessage) ([]planStep, error) { return planChannelState(init, desired) })
+	return nil
+}
+
+// planChannelState diffs the desired channels against the channels of
+// the networks from the given "init" event. Extra channels are parted
+// only when --prune is given.
+func planChannelState(init initMessage, desired channelStateFile) ([]planStep, error) {
+	var ids []string
+	for id := range desired.Networks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var steps []planStep
+	for _, id := range ids {
+		network, err := init.FindNetwork(id)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			expected []string
+			present  []string
+			settings = map[string]desiredChannel{}
+			topics   = map[string]string{}
+		)
+
+		for _, c := range desired.Networks[id] {
+			c.Name = channelName(c.Name)
+			if _, ok := settings[strings.ToLower(c.Name)]; ok {
+				// Channels listed twice use the first declaration
+				continue
+			}
+			expected = append(expected, c.Name)
+			settings[strings.ToLower(c.Name)] = c
+		}
+
+		for _, c := range network.Channels {
+			if c.Type != "channel" {
+				continue
+			}
+			present = append(present, c.Name)
+			topics[strings.ToLower(c.Name)] = c.Topic
+		}
+
+		for _, step := range diffChannels(network.Name, present, expected) {
+			c := settings[strings.ToLower(step.Target)]
+
+			switch step.Op {
+
+			case planAdd:
+				if c.Key != "" {
+					step = step.withKey(c.Key)
+				}
+				steps = append(steps, step)
+				// Topic is sent when the join was confirmed
+				if c.Topic != "" {
+					steps = append(steps, topicStep(network.Name, step.Target, c.Topic))
+				}
+
+			case planRemove:
+				if !cfg.Prune {
+					step = planStep{Op: planRetain, Action: "retain", Network: network.Name, Target: step.Target}
+				}
+				steps = append(steps, step)
+
+			case planRetain:
+				steps = append(steps, step)
+				if c.Topic != "" && c.Topic != topics[strings.ToLower(step.Target)] {
+					steps = append(steps, topicStep(network.Name, step.Target, c.Topic))
+				}
+
+			}
+		}
+	}
+
+	return steps, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Luzifer/lounge-control/loungetest"
+)
+
+// writeChannelState writes the channel state file into a temporary
+// directory and points the --file flag to it
+func writeChannelState(t *testing.T, content string) {
+	dir, err := ioutil.TempDir("", "lounge-control")
+	if err != nil {
+		t.Fatalf("Unable to create directory: %s", err)
+	}
+	t.Cleanup(func() {
+		cfg.File = ""
+		os.RemoveAll(dir)
+	})
+
+	cfg.File = filepath.Join(dir, "channels.yaml")
+	if err = ioutil.WriteFile(cfg.File, []byte(content), 0600); err != nil {
+		t.Fatalf("Unable to write channel state: %s", err)
+	}
+}
+
+const testChannelState = `---
+networks:
+  Libera:
+    - foo
+    - name: "#secret"
+      key: hunter2
+    - name: "#bar"
+      topic: New topic
+  4f5a6b7c:
+    - "#luzifer"
+`
+
+func TestCommandApply(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	writeChannelState(t, testChannelState)
+
+	out, err := runCommand(t, srv, "", "apply")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	if expected := "join #secret\ntopic #bar\n"; out != expected {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	// Extra channels (#oldstream) are retained without --prune
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 1, Text: "/join #secret hunter2"},
+		{Target: 3, Text: "/topic New topic"},
+	})
+
+	// Nothing left to do for the second run
+	if out, err = runCommand(t, srv, "", "apply"); err != nil || out != "" {
+		t.Errorf("Expected second apply to be a no-op, got %q (%v)", out, err)
+	}
+}
+
+func TestCommandApplyPrune(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	writeChannelState(t, testChannelState)
+
+	defer func() { cfg.DryRun, cfg.Prune = false, false }()
+	cfg.DryRun, cfg.Prune = true, true
+
+	out, err := runCommand(t, srv, "", "apply")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	// Networks are planned in order of their names in the file
+	expected := strings.Join([]string{
+		"= retain #luzifer",
+		"- part #oldstream",
+		"+ join #secret",
+		"= retain #foo",
+		"= retain #bar",
+		"~ topic #bar: New topic",
+	}, "\n") + "\n"
+	if out != expected {
+		t.Errorf("Unexpected plan: %q", out)
+	}
+
+	if inputs := srv.Inputs(); len(inputs) != 0 {
+		t.Fatalf("Expected no inputs in dry-run, got %+v", inputs)
+	}
+
+	cfg.DryRun = false
+	if _, err = runCommand(t, srv, "", "apply"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 10, Text: "/part #oldstream"},
+		{Target: 1, Text: "/join #secret hunter2"},
+		{Target: 3, Text: "/topic New topic"},
+	})
+}
+
+func TestCommandApplyDryRunMasksKeys(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	writeChannelState(t, testChannelState)
+
+	defer func() { cfg.DryRun, cfg.Output = false, "" }()
+	cfg.DryRun = true
+
+	for _, format := range []string{outputCSV, outputJSON, outputJSONL, outputTable, outputText, outputYAML, outputTemplate + "={{ .Input }}"} {
+		cfg.Output = format
+
+		out, err := runCommand(t, srv, "", "apply")
+		if err != nil {
+			t.Fatalf("Command with output %q failed: %s", format, err)
+		}
+
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("Channel key printed in %q output:\n%s", format, out)
+		}
+
+		if format != outputText && !strings.Contains(out, "/join #secret "+maskedKey) {
+			t.Errorf("Masked channel key missing in %q output:\n%s", format, out)
+		}
+	}
+}
+
+func TestCommandApplyTopicOfNewChannel(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	srv.JoinErrors = map[string]string{"#evil": "banned_from_channel"}
+
+	writeChannelState(t, `---
+networks:
+  Libera:
+    - name: "#new"
+      topic: Brand new
+    - name: "#evil"
+      topic: Never set
+`)
+
+	defer func() { cfg.DryRun = false }()
+	cfg.DryRun = true
+
+	out, err := runCommand(t, srv, "", "apply")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	expected := strings.Join([]string{
+		"+ join #new",
+		"~ topic #new: Brand new",
+		"+ join #evil",
+		"~ topic #evil: Never set",
+		"= retain #foo",
+		"= retain #bar",
+	}, "\n") + "\n"
+	if out != expected {
+		t.Errorf("Unexpected plan: %q", out)
+	}
+
+	// Topics are set once the join is confirmed in the same run
+	cfg.DryRun = false
+	out, err = runCommand(t, srv, "", "apply")
+	if err == nil || !strings.Contains(err.Error(), "Unable to apply 2 of 4 channels") {
+		t.Errorf("Expected failed join to be reported, got %v", err)
+	}
+
+	expected = strings.Join([]string{
+		"join #new",
+		"topic #new",
+		"join #evil failed: banned_from_channel (Cannot execute /join)",
+		"topic #evil failed: not joined",
+	}, "\n") + "\n"
+	if out != expected {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 1, Text: "/join #new"},
+		{Target: 1, Text: "/join #evil"},
+		{Target: 13, Text: "/topic Brand new"},
+	})
+}
+
+func TestCommandApplyMixedCase(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	writeChannelState(t, `---
+networks:
+  Libera:
+    - "#FOO"
+    - name: "#Bar"
+      topic: New topic
+    - "#bar"
+`)
+
+	defer func() { cfg.Prune = false }()
+	cfg.Prune = true
+
+	out, err := runCommand(t, srv, "", "apply")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	// Channels differing only in case are the same channel
+	if expected := "topic #bar\n"; out != expected {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 3, Text: "/topic New topic"},
+	})
+}
+
+func TestCommandApplyErrors(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	for content, expected := range map[string]int{
+		"networks:\n  Freenode:\n    - foo\n":  exitNetworkNotFound,
+		"channels:\n  - foo\n":                 exitUsage,
+		"networks:\n  Libera:\n    - key: x\n": exitUsage,
+	} {
+		writeChannelState(t, content)
+
+		if _, err := runCommand(t, srv, "", "apply"); exitCode(err) != expected {
+			t.Errorf("Expected exit code %d for %q, got %v", expected, content, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand("history", commandHistory)
+}
+
+func commandHistory(args []string) error {
+	if len(args) != 1 {
+		return usageErrorf("Usage: history <channel>")
+	}
+
+	since, err := parseSince(cfg.Since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var (
+		networkName string
+		target      *channel
+		// messages contains the history fetched so far, oldest first
+		messages []chatMessageContent
+		total    int
+		// pageTimeout fails the command if the requested page is not
+		// received within --timeout
+		pageTimeout *time.Timer
+		finished    bool
+	)
+
+	finish := func() error {
+		finished = true
+
+		var results []messageResult
+		for _, m := range messages {
+			if m.Time.Before(since) || !messageFilter(m) {
+				continue
+			}
+			results = append(results, newMessageResult(networkName, target.Name, m))
+		}
+
+		if cfg.Limit > 0 && len(results) > cfg.Limit {
+			results = results[len(results)-cfg.Limit:]
+		}
+
+		if err := printResults(results); err != nil {
+			return err
+		}
+
+		interrupt <- os.Interrupt
+		return nil
+	}
+
+	// fetchMore requests the page before the oldest message fetched until
+	// the limit, the time bound or the start of the history is reached
+	fetchMore := func() error {
+		switch {
+		case len(messages) == 0, total > 0 && len(messages) >= total:
+			return finish()
+		case !since.IsZero() && messages[0].Time.Before(since):
+			return finish()
+		}
+
+		if cfg.Limit > 0 {
+			var matched int
+			for _, m := range messages {
+				if !m.Time.Before(since) && messageFilter(m) {
+					matched++
+				}
+			}
+
+			if matched >= cfg.Limit {
+				return finish()
+			}
+		}
+
+		if err := client.Emit("more", map[string]interface{}{
+			"target":    target.ID,
+			"lastId":    messages[0].ID,
+			"condensed": false,
+		}); err != nil {
+			return errors.Wrap(err, "Unable to request history")
+		}
+
+		if pageTimeout != nil {
+			pageTimeout.Stop()
+		}
+		if cfg.Timeout > 0 {
+			pageTimeout = time.AfterFunc(cfg.Timeout, func() {
+				commandErrors <- errors.Errorf("Timed out waiting for history of %s", target.Name)
+			})
+		}
+		return nil
+	}
+
+	onInit(func() error {
+		network, err := initData.FindNetwork(cfg.Network)
+		if err != nil {
+			return err
+		}
+
+		if target, err = network.FindChannel(args[0]); err != nil {
+			return err
+		}
+
+		networkName = network.Name
+		messages = append([]chatMessageContent(nil), target.Messages...)
+		total = target.TotalMessages
+
+		return fetchMore()
+	}, func() error {
+		if finished {
+			return nil
+		}
+
+		// The requested page was lost with the connection, request it
+		// again continuing with the messages fetched so far
+		return fetchMore()
+	})
+
+	client.On("more", func(data struct {
+		Chan          int                  `json:"chan"`
+		Messages      []chatMessageContent `json:"messages"`
+		TotalMessages int                  `json:"totalMessages"`
+	}) error {
+		if target == nil || data.Chan != target.ID {
+			return nil
+		}
+
+		if pageTimeout != nil && !pageTimeout.Stop() {
+			// Command already failed
+			return nil
+		}
+
+		if len(data.Messages) == 0 {
+			// Start of the history is reached
+			return finish()
+		}
+
+		messages = append(data.Messages, messages...)
+		total = data.TotalMessages
+
+		return fetchMore()
+	})
+
+	return nil
+}
+
+// parseSince parses the --since flag which is either a duration
+// relative to now or a RFC3339 timestamp. An empty value yields the
+// zero time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, usageErrorf("Invalid time bound %q, expected duration or RFC3339 timestamp", value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandHistory(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	defer func() { cfg.Output = "" }()
+	cfg.Output = outputJSONL
+
+	// Fetching the full history requires two "more" requests
+	out, err := runCommand(t, srv, "Libera", "history", "#bar")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 250 {
+		t.Fatalf("Expected 250 messages, got %d", len(lines))
+	}
+
+	for i, l := range lines {
+		var m messageResult
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatalf("Unable to decode line %q: %s", l, err)
+		}
+
+		if m.ID != i+1 || m.Channel != "#bar" || m.Network != "Libera" || m.From != "alice" {
+			t.Fatalf("Unexpected message at position %d: %+v", i, m)
+		}
+	}
+}
+
+func TestCommandHistoryLimit(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	defer func() { cfg.Limit = 0 }()
+	cfg.Limit = 120
+
+	out, err := runCommand(t, srv, "Libera", "history", "#bar")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 120 {
+		t.Fatalf("Expected 120 messages, got %d", len(lines))
+	}
+
+	ts := testHistoryStart.Add(130 * time.Minute).Local().Format("2006-01-02 15:04:05")
+	if expected := ts + " [Libera/#bar] <alice> message 131"; lines[0] != expected {
+		t.Errorf("Unexpected first line %q, expected %q", lines[0], expected)
+	}
+
+	if !strings.HasSuffix(lines[119], "-alice- message 250") {
+		t.Errorf("Unexpected last line %q", lines[119])
+	}
+}
+
+func TestCommandHistoryTimeout(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	srv.Unresponsive = true
+
+	defer func() { cfg.Timeout = 0 }()
+	cfg.Timeout = 100 * time.Millisecond
+
+	out, err := runCommand(t, srv, "Libera", "history", "#bar")
+	if err == nil || !strings.Contains(err.Error(), "Timed out waiting for history of #bar") {
+		t.Errorf("Expected timeout to be reported, got %v", err)
+	}
+
+	if out != "" {
+		t.Errorf("Expected no output, got %q", out)
+	}
+}
+
+func TestCommandHistoryResumed(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	enableReconnect(t)
+	srv.Unresponsive = true
+
+	defer func() { cfg.Timeout = 0 }()
+	cfg.Timeout = 500 * time.Millisecond
+	deadline := time.Now().Add(cfg.Timeout)
+
+	buf, errC := startCommand(t, srv, "Libera", "history", "#bar")
+
+	// The first page request is lost with the connection
+	srv.SetUnresponsive(false)
+	srv.DropSessions()
+
+	if err := <-errC; err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 250 {
+		t.Errorf("Expected 250 messages, got %d", len(lines))
+	}
+
+	// The timer of the lost request must not fire
+	select {
+	case err := <-commandErrors:
+		t.Errorf("Unexpected command error: %s", err)
+	case <-time.After(time.Until(deadline) + 100*time.Millisecond):
+	}
+}
+
+func TestCommandHistoryFilters(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	defer func() {
+		cfg.MessageTypes = nil
+		cfg.Output = ""
+		cfg.Since = ""
+	}()
+	cfg.MessageTypes = []string{"notice"}
+	cfg.Output = outputCSV
+	cfg.Since = testHistoryStart.Add(199 * time.Minute).Format(time.RFC3339)
+
+	out, err := runCommand(t, srv, "Libera", "history", "#bar")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if lines[0] != "id,time,network,channel,type,from,text,highlight,self" {
+		t.Errorf("Unexpected header: %q", lines[0])
+	}
+
+	var ids []string
+	for _, l := range lines[1:] {
+		ids = append(ids, strings.Split(l, ",")[0])
+	}
+
+	if strings.Join(ids, " ") != "200 210 220 230 240 250" {
+		t.Errorf("Unexpected messages: %q", lines)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for value, expected := range map[string]time.Time{
+		"":                     {},
+		"90m":                  now.Add(-90 * time.Minute),
+		"2020-04-30T08:00:00Z": time.Date(2020, 4, 30, 8, 0, 0, 0, time.UTC),
+	} {
+		since, err := parseSince(value, now)
+		if err != nil {
+			t.Errorf("Unable to parse %q: %s", value, err)
+			continue
+		}
+
+		if !since.Equal(expected) {
+			t.Errorf("Unexpected time for %q: %s", value, since)
+		}
+	}
+
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Error("Expected invalid value to be rejected")
+	}
+}
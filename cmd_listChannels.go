@@ -1,44 +1,60 @@
 package main
 
 import (
-	"errors"
-	"fmt"
 	"os"
 	"sort"
-	"strings"
-
-	"github.com/Luzifer/lounge-control/sioclient"
 )
 
 func init() {
 	registerCommand("list-channels", commandListChannels)
 }
 
-func commandListChannels(args []string) handlerFunc {
-	return addGenericHandler(func(pType string, msg *sioclient.Message) error {
-		if pType != "init" {
-			return nil
-		}
+type channelResult struct {
+	Name      string `json:"name" yaml:"name"`
+	Type      string `json:"type" yaml:"type"`
+	ID        int    `json:"id" yaml:"id"`
+	Topic     string `json:"topic" yaml:"topic"`
+	Unread    int    `json:"unread" yaml:"unread"`
+	Highlight int    `json:"highlight" yaml:"highlight"`
+	Users     int    `json:"users" yaml:"users"`
+}
+
+func (c channelResult) String() string { return c.Name }
 
-		network := initData.NetworkByNameOrUUID(cfg.Network)
-		if network == nil {
-			return errors.New("Network not found")
+func commandListChannels(args []string) error {
+	onInit(func() error {
+		network, err := initData.FindNetwork(cfg.Network)
+		if err != nil {
+			return err
 		}
 
-		var channels []string
+		var channels []channelResult
 
 		for _, c := range network.Channels {
 			if c.Type == "lobby" {
 				continue
 			}
 
-			channels = append(channels, c.Name)
+			channels = append(channels, channelResult{
+				Name:      c.Name,
+				Type:      c.Type,
+				ID:        c.ID,
+				Topic:     c.Topic,
+				Unread:    c.Unread,
+				Highlight: c.Highlight,
+				Users:     len(c.Users),
+			})
 		}
 
-		sort.Strings(channels)
+		sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+
+		if err := printResults(channels); err != nil {
+			return err
+		}
 
-		fmt.Println(strings.Join(channels, "\n"))
 		interrupt <- os.Interrupt
 		return nil
-	})
+	}, nil)
+
+	return nil
 }
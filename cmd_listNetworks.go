@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"sort"
+)
+
+func init() {
+	registerCommand("list-networks", commandListNetworks)
+}
+
+type networkResult struct {
+	UUID      string   `json:"uuid" yaml:"uuid"`
+	Name      string   `json:"name" yaml:"name"`
+	Nick      string   `json:"nick" yaml:"nick"`
+	Connected bool     `json:"connected" yaml:"connected"`
+	Secure    bool     `json:"secure" yaml:"secure"`
+	Network   string   `json:"network" yaml:"network"`
+	ChanTypes []string `json:"chanTypes" yaml:"chanTypes"`
+	Prefix    []string `json:"prefix" yaml:"prefix"`
+}
+
+func commandListNetworks(args []string) error {
+	onInit(func() error {
+		var networks []networkResult
+
+		for _, n := range initData.Networks {
+			networks = append(networks, networkResult{
+				UUID:      n.UUID,
+				Name:      n.Name,
+				Nick:      n.Nick,
+				Connected: n.Status.Connected,
+				Secure:    n.Status.Secure,
+				Network:   n.ServerOptions.NETWORK,
+				ChanTypes: n.ServerOptions.CHANTYPES,
+				Prefix:    n.ServerOptions.PREFIX,
+			})
+		}
+
+		sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+
+		// Text output uses the table as the UUID is required to be shown
+		if err := printResults(networks); err != nil {
+			return err
+		}
+
+		interrupt <- os.Interrupt
+		return nil
+	}, nil)
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	registerCommand("logout", commandLogout)
+}
+
+func commandLogout(args []string) error {
+	onInit(func() error {
+		// Signs out the session we are logged in with, which is the
+		// stored one if it was still valid
+		return errors.Wrap(client.Emit("sign-out"), "Unable to send sign-out")
+	}, nil)
+
+	client.On("sign-out", func() error {
+		if err := state.SetToken(""); err != nil {
+			return errors.Wrap(err, "Unable to remove stored session")
+		}
+
+		log.Info("Session revoked")
+		if err := printResults([]actionResult{{Action: "logout", Target: cfg.Username}}); err != nil {
+			return err
+		}
+
+		interrupt <- os.Interrupt
+		return nil
+	})
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/Luzifer/lounge-control/loungetest"
+)
+
+func TestSessionReuse(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	expectLogins := func(expected ...string) {
+		t.Helper()
+		if logins := srv.Logins(); !reflect.DeepEqual(logins, expected) {
+			t.Errorf("Unexpected logins: %v", logins)
+		}
+	}
+
+	// First run logs in using the password and stores the new session
+	if _, err := runCommand(t, srv, "Libera", "list-channels"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+	expectLogins(loungetest.LoginPassword)
+
+	info, err := os.Stat(cfg.StateFile)
+	if err != nil {
+		t.Fatalf("State file was not written: %s", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected state file to have 0600 permissions, got %o", perm)
+	}
+
+	// Subsequent runs use the token even without password
+	if _, err = runCommandWithPassword(t, srv, "", "Libera", "list-channels"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+	expectLogins(loungetest.LoginPassword, loungetest.LoginToken)
+
+	// Rejected tokens fall back to the password and get replaced
+	srv.RevokeTokens()
+	if _, err = runCommand(t, srv, "Libera", "list-channels"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+	expectLogins(loungetest.LoginPassword, loungetest.LoginToken, loungetest.LoginToken, loungetest.LoginPassword)
+
+	if tokens := srv.Tokens(); len(tokens) != 1 || tokens[0] != state.Token() {
+		t.Errorf("Expected new session %v to be stored, got %q", tokens, state.Token())
+	}
+
+	// Logout revokes the session on the server and removes it locally
+	if _, err = runCommand(t, srv, "Libera", "logout"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	if tokens := srv.Tokens(); len(tokens) != 0 {
+		t.Errorf("Expected all sessions to be revoked, got %v", tokens)
+	}
+
+	if _, err = runCommandWithPassword(t, srv, "", "Libera", "list-channels"); err == nil {
+		t.Error("Expected login without password and session to fail")
+	}
+}
@@ -4,18 +4,15 @@ import (
 	"os"
 
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
-
-	"github.com/Luzifer/lounge-control/sioclient"
 )
 
 func init() {
 	registerCommand("send", commandSend)
 }
 
-func commandSend(args []string) handlerFunc {
+func commandSend(args []string) error {
 	if len(args) != 2 {
-		log.Fatal("Usage: send <target> <message>")
+		return usageErrorf("Usage: send <target> <message>")
 	}
 
 	var (
@@ -23,45 +20,36 @@ func commandSend(args []string) handlerFunc {
 		message     = args[1]
 	)
 
-	return addGenericHandler(func(pType string, msg *sioclient.Message) error {
-		if pType != "init" {
-			return nil
-		}
-
+	onInit(func() error {
 		// After join command is finished we can execute the joins
-		network := initData.NetworkByNameOrUUID(cfg.Network)
-		if network == nil {
-			return errors.New("Network not found")
+		network, err := initData.FindNetwork(cfg.Network)
+		if err != nil {
+			return err
 		}
 
-		var target *channel
-		for _, c := range network.Channels {
-			if channelName == "lobby" && c.Type == "lobby" {
-				target = &c
-				break
-			} else if channelName == c.Name {
-				target = &c
-				break
-			}
+		target, err := network.FindChannel(channelName)
+		if err != nil {
+			return err
 		}
 
-		if target == nil {
-			return errors.New("Unable to find channel in network")
+		if cfg.DryRun {
+			return printPlan([]planStep{{Op: planAdd, Action: "send", Network: network.Name, Target: target.Name, Input: message}})
 		}
 
-		msg, err := sioclient.NewMessage(sioclient.MessageTypeEvent, 0, "input", map[string]interface{}{
+		if err := client.Emit("input", map[string]interface{}{
 			"text":   message,
 			"target": target.ID,
-		})
-		if err != nil {
-			return errors.Wrap(err, "Unable to compose message")
+		}); err != nil {
+			return errors.Wrap(err, "Unable to send message")
 		}
 
-		if err = msg.Send(client); err != nil {
-			return errors.Wrap(err, "Unable to send message")
+		if err := printResults([]actionResult{{Action: "send", Network: network.Name, Target: target.Name, Text: message}}); err != nil {
+			return err
 		}
 
 		interrupt <- os.Interrupt
 		return nil
-	})
+	}, nil)
+
+	return nil
 }
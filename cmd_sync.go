@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	registerCommand("sync", commandSync)
+}
+
+// channelProvider returns the channels the user should be in for the
+// given network
+type channelProvider interface {
+	Channels(network *network) ([]string, error)
+}
+
+// throttledProvider is implemented by providers for networks limiting
+// the rate of joins and parts
+type throttledProvider interface {
+	ActionDelay() time.Duration
+}
+
+// providerFunc creates a provider from the argument given to the sync
+// command. It is called before connecting so providers may interact
+// with the user.
+type providerFunc func(arg string) (channelProvider, error)
+
+var (
+	providers      = map[string]providerFunc{}
+	providersMutex = new(sync.RWMutex)
+)
+
+func availableProviders() (names []string) {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	for k := range providers {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func registerProvider(name string, pf providerFunc) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+
+	if _, ok := providers[name]; ok {
+		log.Fatalf("Duplicate registration of provider %q", name)
+	}
+
+	providers[name] = pf
+}
+
+func commandSync(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return usageErrorf("Usage: sync <provider> [argument]. Available providers: %s", strings.Join(availableProviders(), ", "))
+	}
+
+	providersMutex.RLock()
+	pf, ok := providers[args[0]]
+	providersMutex.RUnlock()
+	if !ok {
+		return usageErrorf("Unknown provider %q. Available providers: %s", args[0], strings.Join(availableProviders(), ", "))
+	}
+
+	var arg string
+	if len(args) == 2 {
+		arg = args[1]
+	}
+
+	provider, err := pf(arg)
+	if err != nil {
+		return err
+	}
+
+	m := registerMembershipChange("sync", func(init initMessage) ([]planStep, error) { return planSync(init, provider) })
+	if tp, ok := provider.(throttledProvider); ok {
+		m.delay = tp.ActionDelay()
+	}
+
+	return nil
+}
+
+// planSync diffs the channels of the network against the channels
+// returned by the provider
+func planSync(init initMessage, provider channelProvider) ([]planStep, error) {
+	network, err := init.FindNetwork(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := provider.Channels(network)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range expected {
+		expected[i] = channelName(expected[i])
+	}
+
+	var present []string
+	for _, c := range network.Channels {
+		if c.Type == "channel" {
+			present = append(present, c.Name)
+		}
+	}
+
+	steps := diffChannels(network.Name, present, expected)
+
+	// Protect against an incomplete channel list wiping the channels
+	if err = checkPartLimit(countSteps(steps, planRemove), len(present)); err != nil {
+		if !cfg.DryRun {
+			return nil, err
+		}
+		log.WithError(err).Warn("Plan exceeds the part limit")
+	}
+
+	return steps, nil
+}
+
+// checkPartLimit refuses to part more channels than allowed by the
+// --part-limit flag (number or percentage of the present channels)
+// unless --force is given
+func checkPartLimit(parts, present int) error {
+	if cfg.Force || cfg.PartLimit == "" || parts == 0 {
+		return nil
+	}
+
+	var (
+		limit int
+		err   error
+	)
+
+	if strings.HasSuffix(cfg.PartLimit, "%") {
+		var percent float64
+		if percent, err = strconv.ParseFloat(strings.TrimSuffix(cfg.PartLimit, "%"), 64); err != nil {
+			return usageErrorf("Invalid part limit %q", cfg.PartLimit)
+		}
+		limit = int(math.Floor(float64(present) * percent / 100))
+		if limit == 0 && percent > 0 {
+			// Small networks would otherwise never be allowed to part
+			// a single channel
+			limit = 1
+		}
+	} else if limit, err = strconv.Atoi(cfg.PartLimit); err != nil {
+		return usageErrorf("Invalid part limit %q", cfg.PartLimit)
+	}
+
+	if parts > limit {
+		return errors.Errorf("Refusing to part %d of %d channels (part limit %s), use --force to part them anyway", parts, present, cfg.PartLimit)
+	}
+
+	return nil
+}
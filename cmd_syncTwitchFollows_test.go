@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Luzifer/lounge-control/loungetest"
+)
+
+const testTwitchClientID = "testclient"
+
+// fakeTwitch emulates the Twitch OAuth and Helix API recording the
+// grants requested from the token endpoint. Like Twitch it lists the
+// followed channels only for user access tokens.
+type fakeTwitch struct {
+	*httptest.Server
+
+	grants []string
+	// pending is the number of device token requests to answer with
+	// "authorization_pending"
+	pending int
+	lock    sync.Mutex
+}
+
+func newFakeTwitch(t *testing.T) *fakeTwitch {
+	f := &fakeTwitch{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+
+	api, auth, delay := twitchAPIBaseURL, twitchAuthBaseURL, twitchActionDelay
+	t.Cleanup(func() { twitchAPIBaseURL, twitchAuthBaseURL, twitchActionDelay = api, auth, delay })
+	twitchAPIBaseURL, twitchAuthBaseURL, twitchActionDelay = f.URL+"/helix", f.URL+"/oauth2", 0
+
+	t.Cleanup(func() {
+		cfg.TwitchClientID, cfg.TwitchClientSecret = "", ""
+	})
+	cfg.TwitchClientID = testTwitchClientID
+
+	return f
+}
+
+func (f *fakeTwitch) Grants() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]string(nil), f.grants...)
+}
+
+func (f *fakeTwitch) handle(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	switch {
+	case r.URL.Path == "/oauth2/device" || r.URL.Path == "/oauth2/token":
+		if r.FormValue("client_id") != testTwitchClientID {
+			http.Error(w, `{"status":400,"message":"invalid client"}`, http.StatusBadRequest)
+			return
+		}
+	case r.Header.Get("Client-Id") != testTwitchClientID,
+		token != "access" && token != "app-access",
+		token == "app-access" && r.URL.Path == "/helix/channels/followed":
+		http.Error(w, `{"status":401,"message":"invalid token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+
+	case r.URL.Path == "/oauth2/device":
+		w.Write([]byte(`{"device_code":"device","expires_in":60,"interval":0,"user_code":"ABCD","verification_uri":"https://example.com/activate"}`))
+
+	case r.URL.Path == "/oauth2/token":
+		grant := r.FormValue("grant_type")
+		f.grants = append(f.grants, grant)
+
+		if grant == "urn:ietf:params:oauth:grant-type:device_code" && f.pending > 0 {
+			f.pending--
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":400,"message":"authorization_pending"}`))
+			return
+		}
+
+		if grant == "client_credentials" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "app-access", "expires_in": 3600})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"expires_in":    3600,
+			"refresh_token": "refresh",
+		})
+
+	case r.URL.Path == "/helix/users" && r.URL.Query().Get("login") == testUser:
+		w.Write([]byte(`{"data":[{"id":"42","login":"luzifer"}]}`))
+
+	case r.URL.Path == "/helix/channels/followed" && r.URL.Query().Get("user_id") == "42":
+		// Follows are split into pages to test the pagination
+		if r.URL.Query().Get("after") == "" {
+			w.Write([]byte(`{"data":[{"broadcaster_login":"luzifer"}],"pagination":{"cursor":"page2"}}`))
+			return
+		}
+		w.Write([]byte(`{"data":[{"broadcaster_login":"newstream"}],"pagination":{}}`))
+
+	default:
+		http.NotFound(w, r)
+
+	}
+}
+
+func TestCommandSyncTwitchFollows(t *testing.T) {
+	api := newFakeTwitch(t)
+	defer api.Close()
+
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	if _, err := runCommand(t, srv, "Twitch", "sync-twitch-follows"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 10, Text: "/join #newstream"},
+		{Target: 10, Text: "/part #oldstream"},
+	})
+
+	// Second run reuses the cached user access token
+	if _, err := runCommand(t, srv, "Twitch", "sync-twitch-follows"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	if grants := api.Grants(); len(grants) != 1 || grants[0] != "urn:ietf:params:oauth:grant-type:device_code" {
+		t.Errorf("Unexpected token grants: %v", grants)
+	}
+}
+
+func TestTwitchDeviceCodeFlow(t *testing.T) {
+	api := newFakeTwitch(t)
+	defer api.Close()
+
+	api.pending = 2
+
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	var err error
+	if state, err = loadState(); err != nil {
+		t.Fatalf("Unable to load state: %s", err)
+	}
+
+	if _, err = newTwitchClient(); err != nil {
+		t.Fatalf("Unable to authorize: %s", err)
+	}
+
+	// Expired tokens are refreshed on the next run
+	key := testTwitchClientID
+	token := state.TwitchToken(key)
+	if token.RefreshToken != "refresh" {
+		t.Fatalf("Expected refresh token to be cached, got %+v", token)
+	}
+	token.ExpiresAt = time.Now().Add(-time.Minute)
+	if err = state.SetTwitchToken(key, token); err != nil {
+		t.Fatalf("Unable to store token: %s", err)
+	}
+
+	if state, err = loadState(); err != nil {
+		t.Fatalf("Unable to load state: %s", err)
+	}
+
+	if _, err = newTwitchClient(); err != nil {
+		t.Fatalf("Unable to authorize: %s", err)
+	}
+
+	expected := []string{
+		"urn:ietf:params:oauth:grant-type:device_code",
+		"urn:ietf:params:oauth:grant-type:device_code",
+		"urn:ietf:params:oauth:grant-type:device_code",
+		"refresh_token",
+	}
+	if grants := api.Grants(); !reflect.DeepEqual(grants, expected) {
+		t.Errorf("Unexpected token grants: %v", grants)
+	}
+
+	if !state.TwitchToken(key).valid() {
+		t.Errorf("Expected refreshed token to be valid")
+	}
+}
+
+func TestTwitchClientOptions(t *testing.T) {
+	api := newFakeTwitch(t)
+	defer api.Close()
+
+	cfg.TwitchClientID = ""
+
+	if _, err := newTwitchClient(); exitCode(err) != exitUsage {
+		t.Errorf("Expected usage error without client ID, got %v", err)
+	}
+}
+
+func TestTwitchRejectedToken(t *testing.T) {
+	api := newFakeTwitch(t)
+	defer api.Close()
+
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	var err error
+	if state, err = loadState(); err != nil {
+		t.Fatalf("Unable to load state: %s", err)
+	}
+
+	// App access tokens are not allowed to read the follows
+	if err = state.SetTwitchToken(testTwitchClientID, twitchToken{AccessToken: "app-access", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Unable to store token: %s", err)
+	}
+
+	_, err = runCommand(t, srv, "Twitch", "sync-twitch-follows")
+	if err == nil || !strings.Contains(err.Error(), "Twitch rejected the access token") {
+		t.Fatalf("Expected rejected token to be reported, got %v", err)
+	}
+
+	if inputs := srv.Inputs(); len(inputs) != 0 {
+		t.Errorf("Expected no channel actions, got %+v", inputs)
+	}
+
+	// The next run authorizes again
+	if state, err = loadState(); err != nil {
+		t.Fatalf("Unable to load state: %s", err)
+	}
+	if token := state.TwitchToken(testTwitchClientID); token.AccessToken != "" {
+		t.Errorf("Expected rejected token to be removed, got %+v", token)
+	}
+}
+
+func TestSyncTwitchFollowsPartLimit(t *testing.T) {
+	api := newFakeTwitch(t)
+	defer api.Close()
+
+	defer func() { cfg.Force, cfg.PartLimit = false, "" }()
+	cfg.PartLimit = "0"
+
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	_, err := runCommand(t, srv, "Twitch", "sync-twitch-follows")
+	if err == nil || !strings.Contains(err.Error(), "Refusing to part 1 of 2 channels") {
+		t.Fatalf("Expected part limit to be enforced, got %v", err)
+	}
+
+	if inputs := srv.Inputs(); len(inputs) != 0 {
+		t.Errorf("Expected no channel actions, got %+v", inputs)
+	}
+
+	cfg.Force = true
+	if _, err = runCommand(t, srv, "Twitch", "sync-twitch-follows"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 10, Text: "/join #newstream"},
+		{Target: 10, Text: "/part #oldstream"},
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Luzifer/lounge-control/loungetest"
+)
+
+func TestParseChannelList(t *testing.T) {
+	network := &network{Name: "Libera", UUID: "0b1c2d3e"}
+
+	for raw, expected := range map[string][]string{
+		`["#foo", "bar"]`:                          {"#foo", "bar"},
+		`{"Libera": ["#foo"], "Twitch": ["#bar"]}`: {"#foo"},
+		`{"0b1c2d3e": ["#foo"]}`:                   {"#foo"},
+		"#foo\n\n  bar  \n":                        {"#foo", "bar"},
+	} {
+		channels, err := parseChannelList([]byte(raw), network)
+		if err != nil {
+			t.Errorf("Unable to parse %q: %s", raw, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(channels, expected) {
+			t.Errorf("Unexpected channels for %q: %v", raw, channels)
+		}
+	}
+
+	if _, err := parseChannelList([]byte(`{"Twitch": ["#bar"]}`), network); err == nil {
+		t.Error("Expected missing network to be reported")
+	}
+}
+
+func TestCommandSyncProviders(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Libera": ["#foo", "#bar", "#new"]}`))
+	}))
+	defer api.Close()
+
+	dir, err := ioutil.TempDir("", "lounge-control")
+	if err != nil {
+		t.Fatalf("Unable to create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	listFile := filepath.Join(dir, "channels.txt")
+	if err = ioutil.WriteFile(listFile, []byte("#foo\nbaz\n"), 0600); err != nil {
+		t.Fatalf("Unable to write channel list: %s", err)
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []loungetest.Input
+	}{
+		{[]string{"sync", "file", listFile}, []loungetest.Input{{Target: 1, Text: "/join #baz"}, {Target: 1, Text: "/part #bar"}}},
+		{[]string{"sync", "command", `printf '#FOO\n#Bar\n#baz\n'`}, []loungetest.Input{{Target: 1, Text: "/join #baz"}}},
+		{[]string{"sync", "http", api.URL}, []loungetest.Input{{Target: 1, Text: "/join #new"}}},
+		{[]string{"sync", "command", `printf '#foo\n#bar\n#%s\n' "$LOUNGE_NETWORK"`}, []loungetest.Input{{Target: 1, Text: "/join #Libera"}}},
+	} {
+		srv := newTestLounge(t)
+
+		if _, err := runCommand(t, srv, "Libera", tc.args...); err != nil {
+			t.Errorf("Command %v failed: %s", tc.args, err)
+		} else {
+			expectInputs(t, srv, tc.expected)
+		}
+
+		srv.Close()
+	}
+}
+
+func TestCommandSyncHTTPTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer api.Close()
+	defer close(hang)
+
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	defer func() { cfg.Timeout = 0 }()
+	cfg.Timeout = 100 * time.Millisecond
+
+	if _, err := runCommand(t, srv, "Libera", "sync", "http", api.URL); err == nil || !strings.Contains(err.Error(), "Unable to fetch channel list") {
+		t.Errorf("Expected request to time out, got %v", err)
+	}
+}
+
+func TestCommandSyncCommandTimeout(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	defer func() { cfg.Timeout = 0 }()
+	cfg.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	if _, err := runCommand(t, srv, "Libera", "sync", "command", "sleep 5; echo '#foo'"); err == nil || !strings.Contains(err.Error(), "Channel list command timed out") {
+		t.Errorf("Expected command to time out, got %v", err)
+	}
+
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Command was not stopped at the deadline, took %s", d)
+	}
+}
+
+func TestCommandSyncResumedWhilePlanning(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	enableReconnect(t)
+
+	_, errC := startCommand(t, srv, "Libera", "sync", "command", "sleep 0.3; echo '#foo'")
+
+	// Connection is lost while the provider is still listing the channels
+	srv.DropSessions()
+
+	if err := <-errC; err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	if inputs := srv.Inputs(); !reflect.DeepEqual(inputs, []loungetest.Input{{Target: 1, Text: "/part #bar"}}) {
+		t.Errorf("Unexpected inputs: %+v", inputs)
+	}
+}
+
+func TestCommandSyncUsage(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	for _, args := range [][]string{
+		{"sync"},
+		{"sync", "carrier-pigeon"},
+		{"sync", "file"},
+		{"sync", "http", "ftp://example.com/channels"},
+		{"sync", "twitch", "luzifer"},
+	} {
+		if _, err := runCommand(t, srv, "Libera", args...); exitCode(err) != exitUsage {
+			t.Errorf("Expected usage error for %v, got %v", args, err)
+		}
+	}
+}
+
+func TestCheckPartLimit(t *testing.T) {
+	defer func() { cfg.PartLimit = "" }()
+
+	for _, tc := range []struct {
+		limit          string
+		parts, present int
+		allowed        bool
+	}{
+		{"", 50, 50, true},
+		{"10", 10, 50, true},
+		{"10", 11, 50, false},
+		{"25%", 12, 50, true},
+		{"25%", 13, 50, false},
+		{"0", 0, 50, true},
+		{"25%", 1, 1, true},
+		{"25%", 1, 3, true},
+		{"25%", 2, 3, false},
+		{"0%", 1, 3, false},
+	} {
+		cfg.PartLimit = tc.limit
+		if err := checkPartLimit(tc.parts, tc.present); (err == nil) != tc.allowed {
+			t.Errorf("Unexpected result for %d of %d with limit %q: %v", tc.parts, tc.present, tc.limit, err)
+		}
+	}
+
+	cfg.PartLimit = "many"
+	if err := checkPartLimit(1, 2); exitCode(err) != exitUsage {
+		t.Errorf("Expected invalid limit to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Luzifer/go_helpers/v2/str"
+)
+
+func init() {
+	registerCommand("tail", commandTail)
+}
+
+// messageResult is a chat message as printed by tail and history
+type messageResult struct {
+	ID        int       `json:"id" yaml:"id"`
+	Time      time.Time `json:"time" yaml:"time"`
+	Network   string    `json:"network" yaml:"network"`
+	Channel   string    `json:"channel" yaml:"channel"`
+	Type      string    `json:"type" yaml:"type"`
+	From      string    `json:"from" yaml:"from"`
+	Text      string    `json:"text" yaml:"text"`
+	Highlight bool      `json:"highlight" yaml:"highlight"`
+	Self      bool      `json:"self" yaml:"self"`
+}
+
+func newMessageResult(network, channel string, m chatMessageContent) messageResult {
+	return messageResult{
+		ID:        m.ID,
+		Time:      m.Time,
+		Network:   network,
+		Channel:   channel,
+		Type:      m.Type,
+		From:      m.From.Nick,
+		Text:      m.Text,
+		Highlight: m.Highlight,
+		Self:      m.Self,
+	}
+}
+
+func (m messageResult) String() string {
+	prefix := fmt.Sprintf("%s [%s/%s]", m.Time.Local().Format("2006-01-02 15:04:05"), m.Network, m.Channel)
+
+	switch m.Type {
+	case "message":
+		return fmt.Sprintf("%s <%s> %s", prefix, m.From, m.Text)
+	case "action":
+		return fmt.Sprintf("%s * %s %s", prefix, m.From, m.Text)
+	case "notice":
+		return fmt.Sprintf("%s -%s- %s", prefix, m.From, m.Text)
+	case "join":
+		return fmt.Sprintf("%s --> %s joined", prefix, m.From)
+	case "part":
+		return strings.TrimSpace(fmt.Sprintf("%s <-- %s left %s", prefix, m.From, m.Text))
+	default:
+		return strings.TrimSpace(fmt.Sprintf("%s [%s] %s %s", prefix, m.Type, m.From, m.Text))
+	}
+}
+
+// messageFilter selects messages by the --type and --highlights-only
+// flags
+func messageFilter(m chatMessageContent) bool {
+	if len(cfg.MessageTypes) > 0 && !str.StringInSlice(m.Type, cfg.MessageTypes) {
+		return false
+	}
+
+	return !cfg.HighlightsOnly || m.Highlight
+}
+
+// matchChannel reports whether the channel was selected by the args
+// given to the command, channels may be given without leading "#"
+func matchChannel(args []string, name string) bool {
+	if len(args) == 0 {
+		return true
+	}
+
+	for _, a := range args {
+		if strings.EqualFold(a, name) || strings.EqualFold("#"+a, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type channelRef struct {
+	Network string
+	Channel string
+}
+
+func commandTail(args []string) error {
+	switch output.name {
+	case outputJSONL, outputTemplate, outputText:
+	default:
+		return usageErrorf("Output format %q is not supported for streaming, use text, jsonl or template", output.name)
+	}
+
+	// channels maps the IDs of the channels to follow to their names
+	var channels = map[int]channelRef{}
+
+	// selectChannels collects the channels to follow from the "init"
+	// event, after reconnects to pick up channels joined meanwhile
+	selectChannels := func() error {
+		networks := initData.Networks
+		if cfg.Network != "" {
+			n, err := initData.FindNetwork(cfg.Network)
+			if err != nil {
+				return err
+			}
+			networks = []network{*n}
+		}
+
+		channels = map[int]channelRef{}
+		for _, n := range networks {
+			for _, c := range n.Channels {
+				if matchChannel(args, c.Name) {
+					channels[c.ID] = channelRef{Network: n.Name, Channel: c.Name}
+				}
+			}
+		}
+
+		return nil
+	}
+	onInit(selectChannels, selectChannels)
+
+	client.On("join", func(data struct {
+		Network string  `json:"network"`
+		Chan    channel `json:"chan"`
+	}) {
+		n := initData.NetworkByNameOrUUID(data.Network)
+		if n == nil || (cfg.Network != "" && n.Name != cfg.Network && n.UUID != cfg.Network) {
+			return
+		}
+
+		if matchChannel(args, data.Chan.Name) {
+			channels[data.Chan.ID] = channelRef{Network: n.Name, Channel: data.Chan.Name}
+		}
+	})
+
+	client.On("part", func(data struct {
+		Chan int `json:"chan"`
+	}) {
+		delete(channels, data.Chan)
+	})
+
+	client.On("msg", func(data chatMessage) error {
+		ref, ok := channels[data.Chan]
+		if !ok || !messageFilter(data.Msg) {
+			return nil
+		}
+
+		return printResults([]messageResult{newMessageResult(ref.Network, ref.Channel, data.Msg)})
+	})
+
+	return nil
+}
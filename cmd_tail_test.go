@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Luzifer/lounge-control/loungetest"
+)
+
+// waitForOutput polls the buffer until it contains the given number of
+// lines or the timeout is reached
+func waitForOutput(t *testing.T, buf *syncBuffer, lines int) []string {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		out := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if out[0] == "" {
+			out = nil
+		}
+
+		if len(out) >= lines {
+			return out
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Received %d of %d lines of output: %q", len(out), lines, out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func stopCommand(t *testing.T, errC <-chan error) {
+	t.Helper()
+
+	interrupt <- os.Interrupt
+	if err := <-errC; err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+}
+
+func tailMessage(chanID int, msgType, from, text string, highlight bool) map[string]interface{} {
+	return map[string]interface{}{
+		"chan": chanID,
+		"msg": map[string]interface{}{
+			"id":        chanID * 100,
+			"time":      time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC),
+			"type":      msgType,
+			"from":      map[string]string{"nick": from},
+			"text":      text,
+			"highlight": highlight,
+		},
+	}
+}
+
+func TestCommandTail(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	buf, errC := startCommand(t, srv, "Libera", "tail", "foo")
+
+	srv.Broadcast("msg", tailMessage(3, "message", "alice", "other channel", false))
+	srv.Broadcast("msg", tailMessage(11, "message", "alice", "other network", false))
+	srv.Broadcast("msg", tailMessage(2, "message", "alice", "Hello", false))
+	srv.Broadcast("msg", tailMessage(2, "action", "bob", "waves", false))
+	srv.Broadcast("msg", tailMessage(2, "notice", "ChanServ", "Welcome", false))
+
+	out := waitForOutput(t, buf, 3)
+	stopCommand(t, errC)
+
+	ts := time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC).Local().Format("2006-01-02 15:04:05")
+	expected := []string{
+		ts + " [Libera/#foo] <alice> Hello",
+		ts + " [Libera/#foo] * bob waves",
+		ts + " [Libera/#foo] -ChanServ- Welcome",
+	}
+
+	if strings.Join(out, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected output: %q", out)
+	}
+}
+
+func TestCommandTailResumed(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	enableReconnect(t)
+
+	buf, errC := startCommand(t, srv, "Libera", "tail", "foo")
+
+	srv.DropSessions()
+	if err := srv.WaitForSession(time.Second); err != nil {
+		t.Fatalf("Command did not resume the session: %s", err)
+	}
+
+	srv.Broadcast("msg", tailMessage(2, "message", "alice", "Welcome back", false))
+
+	out := waitForOutput(t, buf, 1)
+	stopCommand(t, errC)
+
+	if len(out) != 1 || !strings.HasSuffix(out[0], "[Libera/#foo] <alice> Welcome back") {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	if logins := srv.Logins(); len(logins) != 2 || logins[1] != loungetest.LoginToken {
+		t.Errorf("Expected session to be resumed using the token, got %v", logins)
+	}
+}
+
+func TestCommandTailFilters(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	defer func() {
+		cfg.HighlightsOnly = false
+		cfg.MessageTypes = nil
+		cfg.Output = ""
+	}()
+	cfg.HighlightsOnly = true
+	cfg.MessageTypes = []string{"message"}
+	cfg.Output = outputJSONL
+
+	buf, errC := startCommand(t, srv, "", "tail")
+
+	// Channels joined after the start are followed too
+	srv.Broadcast("join", map[string]interface{}{
+		"network": "4f5a6b7c",
+		"chan":    loungetest.Channel{ID: 13, Name: "#newstream", Type: "channel"},
+	})
+
+	srv.Broadcast("msg", tailMessage(2, "message", "alice", "no highlight", false))
+	srv.Broadcast("msg", tailMessage(2, "notice", "alice", "wrong type", true))
+	srv.Broadcast("msg", tailMessage(2, "message", "alice", "luzifer: ping", true))
+	srv.Broadcast("msg", tailMessage(13, "message", "bob", "luzifer: hi", true))
+
+	out := waitForOutput(t, buf, 2)
+	stopCommand(t, errC)
+
+	var results []messageResult
+	for _, l := range out {
+		var r messageResult
+		if err := json.Unmarshal([]byte(l), &r); err != nil {
+			t.Fatalf("Unable to decode output line %q: %s", l, err)
+		}
+		results = append(results, r)
+	}
+
+	if len(results) != 2 ||
+		results[0].Network != "Libera" || results[0].Channel != "#foo" || results[0].Text != "luzifer: ping" ||
+		results[1].Network != "Twitch" || results[1].Channel != "#newstream" || results[1].From != "bob" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+}
+
+func TestCommandTailUnsupportedOutput(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	defer func() { cfg.Output = "" }()
+	cfg.Output = outputJSON
+
+	if _, err := runCommand(t, srv, "", "tail"); err == nil || !strings.Contains(err.Error(), "not supported for streaming") {
+		t.Errorf("Expected output format to be rejected, got %v", err)
+	}
+}
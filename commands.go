@@ -5,13 +5,13 @@ import (
 	"sync"
 
 	log "github.com/sirupsen/logrus"
-
-	"github.com/Luzifer/lounge-control/sioclient"
 )
 
-type commandFunc func(args []string) handlerFunc
-type handlerFunc func(msg *sioclient.Message) error
-type typedHandlerFunc func(mType string, msg *sioclient.Message) error
+// commandFunc validates the arguments and subscribes the handlers the
+// command needs to the client before it is connected. As TheLounge sends
+// the "init" event again after every reconnect commands must not
+// subscribe to it directly but use onInit to not execute twice.
+type commandFunc func(args []string) error
 
 var (
 	commands      = map[string]commandFunc{}
@@ -30,6 +30,26 @@ func availableCommands() (cmds []string) {
 	return cmds
 }
 
+// onInit registers the command to start after the first "init" event.
+// The optional resume function is called for "init" events of sessions
+// resumed after a reconnect to refresh state derived from initData.
+func onInit(start, resume func() error) {
+	var started bool
+
+	client.On("init", func() error {
+		if !started {
+			started = true
+			return start()
+		}
+
+		log.Debug("Session resumed after reconnect")
+		if resume == nil {
+			return nil
+		}
+		return resume()
+	})
+}
+
 func registerCommand(cmd string, cf commandFunc) {
 	commandsMutex.Lock()
 	defer commandsMutex.Unlock()
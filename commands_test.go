@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Luzifer/lounge-control/loungetest"
+)
+
+const (
+	testUser     = "luzifer"
+	testPassword = "secret"
+)
+
+// newTestLounge starts a server with two networks and points the state
+// file into a temporary directory removed after the test
+func newTestLounge(t *testing.T) *loungetest.Server {
+	dir, err := ioutil.TempDir("", "lounge-control")
+	if err != nil {
+		t.Fatalf("Unable to create state directory: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cfg.StateFile = filepath.Join(dir, "state.json")
+
+	return loungetest.NewServer(testUser, testPassword,
+		loungetest.Network{
+			UUID: "0b1c2d3e", Name: "Libera", Nick: testUser,
+			Channels: []loungetest.Channel{
+				{ID: 1, Name: "Libera", Type: "lobby"},
+				{ID: 2, Name: "#foo", Type: "channel", State: loungetest.ChannelJoined},
+				{ID: 3, Name: "#bar", Type: "channel", State: loungetest.ChannelJoined, History: testHistory(250)},
+				{ID: 4, Name: "nickserv", Type: "query"},
+			},
+			ServerOptions: loungetest.ServerOptions{CHANTYPES: []string{"#"}, PREFIX: []string{"@", "+"}, NETWORK: "Libera.Chat"},
+			Status:        loungetest.NetworkStatus{Connected: true, Secure: true},
+		},
+		loungetest.Network{
+			UUID: "4f5a6b7c", Name: "Twitch", Nick: testUser,
+			Channels: []loungetest.Channel{
+				{ID: 10, Name: "Twitch", Type: "lobby"},
+				{ID: 11, Name: "#luzifer", Type: "channel", State: loungetest.ChannelJoined},
+				{ID: 12, Name: "#oldstream", Type: "channel", State: loungetest.ChannelJoined},
+			},
+		},
+	)
+}
+
+// testHistoryStart is the time of the first message of testHistory
+var testHistoryStart = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testHistory creates n messages sent a minute apart with every 10th
+// message being a notice and every 25th message a highlight
+func testHistory(n int) []loungetest.Message {
+	var history []loungetest.Message
+	for i := 1; i <= n; i++ {
+		m := loungetest.Message{
+			ID:        i,
+			Time:      testHistoryStart.Add(time.Duration(i-1) * time.Minute),
+			Type:      "message",
+			From:      loungetest.User{Nick: "alice"},
+			Text:      fmt.Sprintf("message %d", i),
+			Highlight: i%25 == 0,
+		}
+		if i%10 == 0 {
+			m.Type = "notice"
+		}
+		history = append(history, m)
+	}
+
+	return history
+}
+
+// runCommand executes the command against the given server and returns
+// everything written to stdout
+func runCommand(t *testing.T, srv *loungetest.Server, network string, args ...string) (string, error) {
+	t.Helper()
+	return runCommandWithPassword(t, srv, testPassword, network, args...)
+}
+
+func runCommandWithPassword(t *testing.T, srv *loungetest.Server, password, network string, args ...string) (string, error) {
+	t.Helper()
+
+	buf := prepareCommand(srv, password, network)
+	err := run(args)
+	return buf.String(), err
+}
+
+// startCommand executes a long running command in the background and
+// returns its output buffer and a channel receiving its result after
+// it was interrupted
+func startCommand(t *testing.T, srv *loungetest.Server, network string, args ...string) (*syncBuffer, <-chan error) {
+	t.Helper()
+
+	buf := prepareCommand(srv, testPassword, network)
+	errC := make(chan error, 1)
+	go func() { errC <- run(args) }()
+
+	if err := srv.WaitForSession(time.Second); err != nil {
+		t.Fatalf("Command did not log in: %s", err)
+	}
+
+	return buf, errC
+}
+
+// prepareCommand configures the client for the given server and
+// redirects stdout into the returned buffer
+func prepareCommand(srv *loungetest.Server, password, network string) *syncBuffer {
+	cfg.EIOVersion = 3
+	cfg.HandshakeTimeout = time.Second
+	cfg.Network = network
+	if cfg.Output == "" {
+		cfg.Output = outputText
+	}
+	cfg.Password = password
+	cfg.SocketURL = srv.URL()
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Second
+	}
+	cfg.Transport = "websocket"
+	cfg.Username = testUser
+
+	buf := new(syncBuffer)
+	stdout = buf
+	initData = initMessage{}
+
+	return buf
+}
+
+// enableReconnect makes the client redial connections dropped by the
+// server (see loungetest.Server.DropSessions) during the test
+func enableReconnect(t *testing.T) {
+	t.Cleanup(func() { cfg.ReconnectAttempts, cfg.ReconnectBackoff = 0, 0 })
+	cfg.ReconnectAttempts, cfg.ReconnectBackoff = 3, 10*time.Millisecond
+}
+
+// syncBuffer is a bytes.Buffer safe to be read while commands write
+// into it
+type syncBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (s *syncBuffer) String() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.buf.String()
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.buf.Write(p)
+}
+
+func expectInputs(t *testing.T, srv *loungetest.Server, expected []loungetest.Input) {
+	t.Helper()
+
+	inputs, err := srv.WaitForInputs(len(expected), time.Second)
+	if err != nil {
+		t.Fatalf("Missing inputs: %s", err)
+	}
+
+	if !reflect.DeepEqual(inputs, expected) {
+		t.Errorf("Unexpected inputs: %+v", inputs)
+	}
+}
+
+func TestCommandJoin(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	if _, err := runCommand(t, srv, "Libera", "join", "baz", "#qux"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 1, Text: "/join #baz"},
+		{Target: 1, Text: "/join #qux"},
+	})
+}
+
+func TestCommandPart(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	// Network can be selected by its UUID too
+	if _, err := runCommand(t, srv, "0b1c2d3e", "part", "foo"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 1, Text: "/part #foo"},
+	})
+}
+
+func TestCommandSend(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	if _, err := runCommand(t, srv, "Libera", "send", "#bar", "Hello World"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	if _, err := runCommand(t, srv, "Libera", "send", "lobby", "/msg nickserv identify"); err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	expectInputs(t, srv, []loungetest.Input{
+		{Target: 3, Text: "Hello World"},
+		{Target: 1, Text: "/msg nickserv identify"},
+	})
+
+	if _, err := runCommand(t, srv, "Libera", "send", "#unknown", "Hello"); err == nil {
+		t.Error("Expected sending to unknown channel to fail")
+	}
+
+	if _, err := runCommand(t, srv, "Libera", "send", "#bar"); err == nil {
+		t.Error("Expected send without message to fail")
+	}
+}
+
+func TestCommandListChannels(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	out, err := runCommand(t, srv, "Libera", "list-channels")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	if expected := "#bar\n#foo\nnickserv\n"; out != expected {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	_, err = runCommand(t, srv, "Unknown", "list-channels")
+	if err == nil || !strings.Contains(err.Error(), "Available networks: Libera (0b1c2d3e), Twitch (4f5a6b7c)") {
+		t.Errorf("Expected unknown network to fail listing networks, got %v", err)
+	}
+
+	if inputs := srv.Inputs(); len(inputs) != 0 {
+		t.Errorf("Expected no inputs, got %+v", inputs)
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+	defer func() { cfg.Output = "" }()
+
+	for _, tc := range []struct {
+		format   string
+		expected string
+	}{
+		{outputText, "#bar\n#foo\nnickserv\n"},
+		{outputJSONL, `{"name":"#bar","type":"channel","id":3,"topic":"","unread":0,"highlight":0,"users":0}` + "\n" +
+			`{"name":"#foo","type":"channel","id":2,"topic":"","unread":0,"highlight":0,"users":0}` + "\n" +
+			`{"name":"nickserv","type":"query","id":4,"topic":"","unread":0,"highlight":0,"users":0}` + "\n"},
+		{outputTemplate + "={{ .ID }}:{{ .Name }}", "3:#bar\n2:#foo\n4:nickserv\n"},
+		{outputTable, "NAME      TYPE     ID  TOPIC  UNREAD  HIGHLIGHT  USERS\n" +
+			"#bar      channel  3          0       0          0\n" +
+			"#foo      channel  2          0       0          0\n" +
+			"nickserv  query    4          0       0          0\n"},
+		{outputYAML, "- name: '#bar'\n  type: channel\n  id: 3\n  topic: \"\"\n  unread: 0\n  highlight: 0\n  users: 0\n" +
+			"- name: '#foo'\n  type: channel\n  id: 2\n  topic: \"\"\n  unread: 0\n  highlight: 0\n  users: 0\n" +
+			"- name: nickserv\n  type: query\n  id: 4\n  topic: \"\"\n  unread: 0\n  highlight: 0\n  users: 0\n"},
+	} {
+		cfg.Output = tc.format
+
+		out, err := runCommand(t, srv, "Libera", "list-channels")
+		if err != nil {
+			t.Fatalf("Command with output %q failed: %s", tc.format, err)
+		}
+
+		if out != tc.expected {
+			t.Errorf("Unexpected %q output:\n%s", tc.format, out)
+		}
+	}
+
+	cfg.Output = outputJSON
+	out, err := runCommand(t, srv, "Libera", "join", "baz")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	var results []actionResult
+	if err = json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("Unable to parse JSON output: %s", err)
+	}
+
+	if expected := []actionResult{{Action: "join", Network: "Libera", Target: "#baz"}}; !reflect.DeepEqual(results, expected) {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+
+	for _, spec := range []string{"xml", outputTemplate, outputTemplate + "={{ .Name"} {
+		if _, err = parseOutputFormat(spec); err == nil {
+			t.Errorf("Expected output format %q to be rejected", spec)
+		}
+	}
+}
+
+func TestCommandListNetworks(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+	defer func() { cfg.Output = "" }()
+
+	cfg.Output = outputJSONL
+	out, err := runCommand(t, srv, "", "list-networks")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	expected := `{"uuid":"0b1c2d3e","name":"Libera","nick":"luzifer","connected":true,"secure":true,"network":"Libera.Chat","chanTypes":["#"],"prefix":["@","+"]}` + "\n" +
+		`{"uuid":"4f5a6b7c","name":"Twitch","nick":"luzifer","connected":false,"secure":false,"network":"","chanTypes":null,"prefix":null}` + "\n"
+	if out != expected {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/Luzifer/rconfig/v2"
+)
+
+const defaultProfile = "default"
+
+// configFile holds named profiles, each of them mapping flag names
+// (i.e. "socket-url", "username", "network") to their values:
+//
+//	default_profile: work
+//	profiles:
+//	  work:
+//	    socket-url: wss://lounge.example.com/socket.io/
+//	    username: luzifer
+//	    network: Libera
+//	    tls-ca-file: /etc/ssl/example-ca.pem
+type configFile struct {
+	DefaultProfile string                            `yaml:"default_profile"`
+	Profiles       map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// loadConfigFile makes the values of the selected profile the defaults
+// of the corresponding flags so flags and environment variables still
+// override them
+func loadConfigFile(args []string) error {
+	defaults, err := profileDefaults(args)
+	if err != nil {
+		return err
+	}
+
+	rconfig.SetVariableDefaults(defaults)
+	return nil
+}
+
+// profileDefaults reads the config file and the profile given in the
+// arguments (or the environment) and returns the values of the profile
+func profileDefaults(args []string) (map[string]string, error) {
+	filename := argValue(args, "config", os.Getenv("CONFIG"))
+	explicitFile := filename != ""
+
+	if !explicitFile {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			// Without config directory there is no default file to load
+			return nil, nil
+		}
+		filename = filepath.Join(dir, "lounge-control", "config.yml")
+	}
+
+	raw, err := ioutil.ReadFile(filename)
+	switch {
+	case os.IsNotExist(err) && !explicitFile:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "Unable to read config file")
+	}
+
+	var file configFile
+	if err = yaml.Unmarshal(raw, &file); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse config file")
+	}
+
+	profile := argValue(args, "profile", os.Getenv("PROFILE"))
+	explicitProfile := profile != ""
+
+	if !explicitProfile {
+		profile = file.DefaultProfile
+	}
+	if profile == "" {
+		profile = defaultProfile
+	}
+
+	values, ok := file.Profiles[profile]
+	if !ok {
+		if !explicitProfile && file.DefaultProfile == "" {
+			// The file might only contain named profiles to be selected
+			return nil, nil
+		}
+
+		var available []string
+		for name := range file.Profiles {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+
+		return nil, errors.Errorf("Profile %q not found in %s. Available profiles: %s", profile, filename, strings.Join(available, ", "))
+	}
+
+	known := profileOptions()
+	defaults := map[string]string{}
+
+	for k, v := range values {
+		if !known[k] {
+			return nil, errors.Errorf("Unknown option %q in profile %q", k, profile)
+		}
+
+		switch v := v.(type) {
+		case []interface{}:
+			// List flags take comma separated defaults
+			var items []string
+			for _, i := range v {
+				items = append(items, fmt.Sprint(i))
+			}
+			defaults[k] = strings.Join(items, ",")
+
+		default:
+			defaults[k] = fmt.Sprint(v)
+		}
+	}
+
+	return defaults, nil
+}
+
+// argValue extracts the value of a long flag from the arguments before
+// they are parsed by rconfig as the config file changes their defaults
+func argValue(args []string, name, fallback string) string {
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return fallback
+		case arg == "--"+name && i+1 < len(args):
+			return args[i+1]
+		case strings.HasPrefix(arg, "--"+name+"="):
+			return strings.TrimPrefix(arg, "--"+name+"=")
+		}
+	}
+
+	return fallback
+}
+
+// profileOptions returns the names of the options which may be set in
+// profiles, which are all flags having a vardefault tag
+func profileOptions() map[string]bool {
+	var (
+		opts = map[string]bool{}
+		t    = reflect.TypeOf(cfg)
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("vardefault"); name != "" {
+			opts[name] = true
+		}
+	}
+
+	return opts
+}
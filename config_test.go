@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProfileDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lounge-control")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.yml")
+	if err = ioutil.WriteFile(configFile, []byte(`---
+default_profile: work
+profiles:
+  work:
+    socket-url: wss://work.example.com/socket.io/
+    username: luzifer
+    network: Libera
+    header: ["X-Auth: secret", "X-Env: work"]
+  home:
+    socket-url: wss://home.example.com/socket.io/
+    reconnect-attempts: -1
+  broken:
+    unknown-option: true
+`), 0600); err != nil {
+		t.Fatalf("Unable to write config: %s", err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name: "default profile of file",
+			args: []string{"--config", configFile, "list-channels"},
+			expected: map[string]string{
+				"socket-url": "wss://work.example.com/socket.io/",
+				"username":   "luzifer",
+				"network":    "Libera",
+				"header":     "X-Auth: secret,X-Env: work",
+			},
+		},
+		{
+			name: "selected profile",
+			args: []string{"--config=" + configFile, "-u", "other", "--profile", "home", "join", "#foo"},
+			expected: map[string]string{
+				"socket-url":         "wss://home.example.com/socket.io/",
+				"reconnect-attempts": "-1",
+			},
+		},
+		{
+			name: "arguments after terminator are ignored",
+			args: []string{"--config", configFile, "send", "--", "--profile", "home"},
+			expected: map[string]string{
+				"socket-url": "wss://work.example.com/socket.io/",
+				"username":   "luzifer",
+				"network":    "Libera",
+				"header":     "X-Auth: secret,X-Env: work",
+			},
+		},
+		{name: "unknown profile", args: []string{"--config", configFile, "--profile", "missing"}, expectErr: true},
+		{name: "unknown option", args: []string{"--config", configFile, "--profile", "broken"}, expectErr: true},
+		{name: "missing explicit file", args: []string{"--config", filepath.Join(dir, "missing.yml")}, expectErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defaults, err := profileDefaults(tc.args)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got defaults %v", defaults)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unable to load profile: %s", err)
+			}
+
+			if !reflect.DeepEqual(defaults, tc.expected) {
+				t.Errorf("Unexpected defaults: %v", defaults)
+			}
+		})
+	}
+}
@@ -1,3 +0,0 @@
-package main
-
-const twitchClientID = "53govsefmz3c7pd5ev8slxlphtfo1j"
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Luzifer/lounge-control/sioclient"
+)
+
+// applyDialerOptions translates the proxy, TLS, header and cookie flags
+// into the client configuration
+func applyDialerOptions(c *sioclient.Config) error {
+	c.HandshakeTimeout = cfg.HandshakeTimeout
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return errors.Wrap(err, "Unable to parse proxy URL")
+		}
+		c.Proxy = proxy
+	}
+
+	tlsConfig, err := buildTLSConfig()
+	if err != nil {
+		return err
+	}
+	c.TLSConfig = tlsConfig
+
+	if len(cfg.Headers) > 0 {
+		c.Header = http.Header{}
+		for _, h := range cfg.Headers {
+			parts := strings.SplitN(h, ":", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+				return errors.Errorf("Invalid header %q, expected 'Name: value'", h)
+			}
+			c.Header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		}
+	}
+
+	if len(cfg.Cookies) > 0 {
+		if c.Jar, err = buildCookieJar(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func buildCookieJar() (http.CookieJar, error) {
+	socketURL, err := url.Parse(cfg.SocketURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to parse socket URL")
+	}
+
+	// Cookies are looked up using the HTTP URL of the server
+	switch socketURL.Scheme {
+	case "ws":
+		socketURL.Scheme = "http"
+	case "wss":
+		socketURL.Scheme = "https"
+	}
+
+	var cookies []*http.Cookie
+	for _, c := range cfg.Cookies {
+		parts := strings.SplitN(c, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("Invalid cookie %q, expected 'name=value'", c)
+		}
+		cookies = append(cookies, &http.Cookie{Name: parts[0], Value: parts[1]})
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create cookie jar")
+	}
+	jar.SetCookies(socketURL, cookies)
+
+	return jar, nil
+}
+
+func buildTLSConfig() (*tls.Config, error) {
+	if cfg.TLSCAFile == "" && cfg.TLSClientCert == "" && cfg.TLSClientKey == "" && !cfg.TLSInsecureSkipVerify {
+		// Go defaults are fine
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to read CA file")
+		}
+
+		if tlsConfig.RootCAs, err = x509.SystemCertPool(); err != nil || tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		}
+
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("CA file did not contain any certificates")
+		}
+	}
+
+	if cfg.TLSClientCert != "" || cfg.TLSClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSClientCert, cfg.TLSClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
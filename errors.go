@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Luzifer/lounge-control/sioclient"
+)
+
+// Exit codes of the process, documented in the README
+const (
+	exitGeneric          = 1
+	exitUsage            = 2
+	exitAuth             = 3
+	exitNetworkNotFound  = 4
+	exitChannelNotFound  = 5
+	exitConnectionFailed = 6
+)
+
+// errAuthFailed is returned when the server rejected the credentials
+var errAuthFailed = errors.New("Login failed")
+
+// usageError is returned for invalid commandline arguments or options
+type usageError struct{ error }
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{errors.Errorf(format, args...)}
+}
+
+// connectionError is returned when the server could not be reached
+type connectionError struct{ error }
+
+type networkNotFoundError struct {
+	ID        string
+	Available []string
+}
+
+func (n networkNotFoundError) Error() string {
+	if n.ID == "" {
+		return fmt.Sprintf("No network given. Available networks: %s", strings.Join(n.Available, ", "))
+	}
+	return fmt.Sprintf("Network %q not found. Available networks: %s", n.ID, strings.Join(n.Available, ", "))
+}
+
+type channelNotFoundError struct {
+	Channel string
+	Network string
+}
+
+func (c channelNotFoundError) Error() string {
+	return fmt.Sprintf("Channel %q not found in network %q", c.Channel, c.Network)
+}
+
+// exitCode maps the cause of the error to the exit code of the process
+func exitCode(err error) int {
+	cause := errors.Cause(err)
+
+	switch cause.(type) {
+	case usageError:
+		return exitUsage
+	case networkNotFoundError:
+		return exitNetworkNotFound
+	case channelNotFoundError:
+		return exitChannelNotFound
+	case connectionError, sioclient.ConnectionLostError, sioclient.PingTimeoutError:
+		return exitConnectionFailed
+	}
+
+	switch cause {
+	case errAuthFailed:
+		return exitAuth
+	case sioclient.ErrReconnectFailed:
+		return exitConnectionFailed
+	}
+
+	return exitGeneric
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/Luzifer/lounge-control/sioclient"
+)
+
+func TestExitCodes(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	srv.JoinErrors = map[string]string{"#evil": "banned_from_channel"}
+
+	for name, tc := range map[string]struct {
+		password string
+		network  string
+		args     []string
+		expected int
+	}{
+		"usage":             {testPassword, "Libera", []string{"send", "#foo"}, exitUsage},
+		"unknown command":   {testPassword, "Libera", []string{"foo"}, exitUsage},
+		"auth":              {"wrong", "Libera", []string{"list-channels"}, exitAuth},
+		"network not found": {testPassword, "Freenode", []string{"list-channels"}, exitNetworkNotFound},
+		"channel not found": {testPassword, "Libera", []string{"send", "#nope", "hi"}, exitChannelNotFound},
+		"part not found":    {testPassword, "Libera", []string{"part", "#nope"}, exitChannelNotFound},
+		"membership failed": {testPassword, "Libera", []string{"join", "#evil"}, exitGeneric},
+	} {
+		// Stored sessions would bypass the password check
+		os.Remove(cfg.StateFile)
+
+		_, err := runCommandWithPassword(t, srv, tc.password, tc.network, tc.args...)
+		if err == nil {
+			t.Errorf("%s: Expected command to fail", name)
+			continue
+		}
+
+		if code := exitCode(err); code != tc.expected {
+			t.Errorf("%s: Expected exit code %d, got %d (%s)", name, tc.expected, code, err)
+		}
+	}
+
+	// Server being unavailable is reported as connection failure
+	srv.Close()
+	_, err := runCommand(t, srv, "Libera", "list-channels")
+	if code := exitCode(err); code != exitConnectionFailed {
+		t.Errorf("Expected exit code %d for unavailable server, got %d (%v)", exitConnectionFailed, code, err)
+	}
+
+	for _, err := range []error{
+		errors.Wrap(sioclient.ConnectionLostError{Err: errors.New("EOF")}, "Handler failed"),
+		errors.Wrap(sioclient.ErrReconnectFailed, "Gave up"),
+	} {
+		if code := exitCode(err); code != exitConnectionFailed {
+			t.Errorf("Expected exit code %d for %q, got %d", exitConnectionFailed, err, code)
+		}
+	}
+}
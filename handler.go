@@ -1,122 +1,73 @@
 package main
 
 import (
-	"encoding/json"
-
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-
-	"github.com/Luzifer/lounge-control/sioclient"
 )
 
-func addGenericHandler(f typedHandlerFunc) handlerFunc {
-	return func(msg *sioclient.Message) error {
-		if msg.Type != sioclient.MessageTypeEvent {
-			// We don't care about anything but events
-			return nil
-		}
-
-		pType, err := msg.PayloadType()
-		if err != nil {
-			log.Printf("Event message had no payload type: %#v - %s", msg, err)
-			return nil
-		}
-
-		switch pType {
-
-		case "auth:failed":
-			log.Fatal("Login failed")
-
-		case "auth:start":
-			msg, err := sioclient.NewMessage(sioclient.MessageTypeEvent, 0, "auth:perform", map[string]string{"user": cfg.Username, "password": cfg.Password})
+// registerGenericHandlers subscribes the handlers required for every
+// command. They are registered before the command handlers and
+// therefore called first, so initData is available in the command
+// handlers for the "init" event.
+func registerGenericHandlers() {
+	// Whether the last auth:perform used the stored token instead of
+	// the password
+	var tokenLogin bool
+
+	performLogin := func() error {
+		payload := map[string]interface{}{"user": cfg.Username}
+
+		if token := state.Token(); token != "" && !tokenLogin {
+			log.Debug("Logging in using stored session")
+			tokenLogin = true
+			payload["token"] = token
+			// Values TheLounge expects on token logins, we do not have any
+			// messages or channels to restore
+			payload["lastMessage"] = -1
+			payload["openChannel"] = -1
+		} else {
+			pass, err := password()
 			if err != nil {
-				return errors.Wrap(err, "Unable to create auth:peform")
-			}
-
-			if err := msg.Send(client); err != nil {
-				return errors.Wrap(err, "Unable to create payload")
+				return err
 			}
-
-		case "init":
-			if err := json.Unmarshal(msg.Payload[1], &initData); err != nil {
-				return errors.Wrap(err, "Unable to parse init payload")
-			}
-
+			tokenLogin = false
+			payload["password"] = pass
 		}
 
-		return f(pType, msg)
-	}
-}
-
-// DEPRECATED: Only storing code for now
-func handleMessage(msg *sioclient.Message) error {
-	if msg.Type != sioclient.MessageTypeEvent {
-		// We don't care about anything but events
-		return nil
-	}
-
-	pType, err := msg.PayloadType()
-	if err != nil {
-		log.Printf("Event message had no payload type: %#v - %s", msg, err)
-		return nil
+		return errors.Wrap(client.Emit("auth:perform", payload), "Unable to send auth:perform")
 	}
 
-	switch pType {
-
-	case "auth:failed":
-		log.Fatal("Login failed")
-
-	case "auth:start":
-		msg, err := sioclient.NewMessage(sioclient.MessageTypeEvent, 0, "auth:perform", map[string]string{"user": cfg.Username, "password": cfg.Password})
-		if err != nil {
-			return errors.Wrap(err, "Unable to create auth:peform")
-		}
-
-		if err := msg.Send(client); err != nil {
-			return errors.Wrap(err, "Unable to create payload")
+	client.On("auth:failed", func() error {
+		if !tokenLogin {
+			return errAuthFailed
 		}
 
-	case "auth:success":
-		log.Info("Logged in successfully")
-
-	case "init":
-		if err := json.Unmarshal(msg.Payload[1], &initData); err != nil {
-			return errors.Wrap(err, "Unable to parse init payload")
-		}
-
-	case "msg":
-		// Message in channel
-		var payload chatMessage
-		if err := json.Unmarshal(msg.Payload[1], &payload); err != nil {
-			return errors.Wrap(err, "Unable to parse init payload")
+		log.Warn("Stored session was rejected, logging in using password")
+		if err := state.SetToken(""); err != nil {
+			return errors.Wrap(err, "Unable to remove rejected session")
 		}
 
-		switch payload.Msg.Type {
-
-		case "join", "part":
-			// Don't care
+		return performLogin()
+	})
 
-		case "message", "notice":
-			//log.Infof("Msg: %#v", payload)
+	client.On("auth:start", func() error {
+		// Start over with the stored token after reconnects
+		tokenLogin = false
+		return performLogin()
+	})
 
-		case "unhandled":
-			log.Infof("CMD: %s", msg.Payload[1])
+	client.On("auth:success", func() {
+		log.Debug("Logged in successfully")
+	})
 
-		default:
-			log.Infof("Unhandled message %q: %#v", payload.Msg.Type, payload)
+	client.On("init", func(data initMessage) error {
+		initData = data
 
-		}
-
-	case "commands", "configuration", "names", "open", "push:issubscribed", "users":
-		// Drop irrelevantt messages
-
-	default:
-		if len(msg.Payload) == 2 {
-			log.Warnf("Recieved unhandled message %q: %s", pType, msg.Payload[1])
+		if data.Token == "" {
+			// TheLounge only sends a token when a new session was created
 			return nil
 		}
-		log.Warnf("Recieved unhandled message %q: %#v", pType, msg)
-	}
 
-	return nil
+		return errors.Wrap(state.SetToken(data.Token), "Unable to store session")
+	})
 }
@@ -0,0 +1,659 @@
+// Package loungetest provides an in-process server emulating the
+// Socket.IO API of TheLounge to test clients without network access
+package loungetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+
+	"github.com/Luzifer/lounge-control/sioclient"
+)
+
+// ChannelJoined is the State of channels the user is in
+const ChannelJoined = 1
+
+// historyPageSize is the number of messages TheLounge sends for every
+// "more" request and in the "init" event
+const historyPageSize = 100
+
+type Channel struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Type is one of "lobby", "channel" or "query"
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+	// State is 1 (ChannelJoined) for channels the user is in and 0
+	// for channels the user was kicked from or which were parted
+	// before the network reconnected
+	State int `json:"state"`
+	// History contains the messages of the channel, oldest first. The
+	// client receives the last page in the "init" event and has to
+	// request older ones using the "more" event.
+	History []Message `json:"-"`
+}
+
+// MarshalJSON encodes the channel as sent in the "init" event
+func (c Channel) MarshalJSON() ([]byte, error) {
+	type channel Channel
+
+	return json.Marshal(struct {
+		channel
+		Messages      []Message `json:"messages"`
+		TotalMessages int       `json:"totalMessages"`
+	}{
+		channel:       channel(c),
+		Messages:      historyPage(c.History, len(c.History)),
+		TotalMessages: len(c.History),
+	})
+}
+
+type Message struct {
+	ID        int       `json:"id"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	From      User      `json:"from"`
+	Text      string    `json:"text"`
+	Highlight bool      `json:"highlight"`
+}
+
+type User struct {
+	Nick string `json:"nick"`
+}
+
+// historyPage returns the page of messages before the given index
+func historyPage(history []Message, before int) []Message {
+	start := before - historyPageSize
+	if start < 0 {
+		start = 0
+	}
+
+	return append([]Message{}, history[start:before]...)
+}
+
+type Network struct {
+	UUID          string        `json:"uuid"`
+	Name          string        `json:"name"`
+	Nick          string        `json:"nick"`
+	Channels      []Channel     `json:"channels"`
+	ServerOptions ServerOptions `json:"serverOptions"`
+	Status        NetworkStatus `json:"status"`
+}
+
+// ServerOptions contains the ISUPPORT values of the IRC server
+type ServerOptions struct {
+	CHANTYPES []string `json:"CHANTYPES"`
+	PREFIX    []string `json:"PREFIX"`
+	NETWORK   string   `json:"NETWORK"`
+}
+
+type NetworkStatus struct {
+	Connected bool `json:"connected"`
+	Secure    bool `json:"secure"`
+}
+
+// Input is the payload of an "input" event sent by the client, which
+// is what TheLounge receives when text is typed into a channel
+type Input struct {
+	Target int    `json:"target"`
+	Text   string `json:"text"`
+}
+
+// Login methods recorded by the server
+const (
+	LoginPassword = "password"
+	LoginToken    = "token"
+)
+
+// Server accepts logins with the configured credentials and presents
+// the scripted networks in the "init" event. Joins and parts sent as
+// input are executed on the networks and confirmed like TheLounge
+// does. Password logins create a session token which can be used to
+// log in afterwards. All inputs and logins received are recorded in
+// order.
+type Server struct {
+	// JoinErrors maps channel names to the IRC error (i.e.
+	// "banned_from_channel") reported when joining them
+	JoinErrors map[string]string
+	Networks   []Network
+	Password   string
+	// Unresponsive makes the server record inputs without executing
+	// the commands in them and ignore requests for more history. Use
+	// SetUnresponsive to change it while clients are connected.
+	Unresponsive bool
+	User         string
+
+	http *httptest.Server
+
+	// changed is signalled when inputs or sessions change
+	changed   *sync.Cond
+	inputs    []Input
+	lastToken int
+	logins    []string
+	sessions  map[*conn]bool
+	tokens    map[string]bool
+	lock      sync.Mutex
+}
+
+// NewServer starts a server speaking Engine.IO v3 or v4 over websocket
+// depending on the version requested by the client
+func NewServer(user, password string, networks ...Network) *Server {
+	s := &Server{
+		Networks: networks,
+		Password: password,
+		User:     user,
+
+		sessions: map[*conn]bool{},
+		tokens:   map[string]bool{},
+	}
+
+	s.changed = sync.NewCond(&s.lock)
+	s.http = httptest.NewServer(http.HandlerFunc(s.handleRequest))
+
+	return s
+}
+
+// Broadcast sends an event to all logged in clients
+func (s *Server) Broadcast(event string, data interface{}) {
+	s.lock.Lock()
+	var sessions []*conn
+	for c := range s.sessions {
+		sessions = append(sessions, c)
+	}
+	s.lock.Unlock()
+
+	for _, c := range sessions {
+		c.emit(event, data)
+	}
+}
+
+func (s *Server) Close() { s.http.Close() }
+
+// DropSessions closes the connections of all logged in clients without
+// closing the session as if the network failed and waits until they
+// are gone
+func (s *Server) DropSessions() {
+	s.lock.Lock()
+	for c := range s.sessions {
+		c.ws.Close()
+	}
+	s.lock.Unlock()
+
+	s.waitFor(time.Second, func() bool { return len(s.sessions) == 0 })
+}
+
+// Inputs returns a copy of all inputs received so far
+func (s *Server) Inputs() []Input {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Input(nil), s.inputs...)
+}
+
+// Logins returns the methods (LoginPassword, LoginToken) of all login
+// attempts received so far
+func (s *Server) Logins() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.logins...)
+}
+
+// RevokeTokens invalidates all sessions as if the user signed out of
+// them in the browser
+func (s *Server) RevokeTokens() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tokens = map[string]bool{}
+}
+
+// Tokens returns the valid session tokens
+func (s *Server) Tokens() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var tokens []string
+	for t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Strings(tokens)
+
+	return tokens
+}
+
+// SetUnresponsive changes Unresponsive while clients are connected
+func (s *Server) SetUnresponsive(unresponsive bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Unresponsive = unresponsive
+}
+
+// URL returns the websocket URL to pass to the client
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.http.URL, "http") + "/socket.io/"
+}
+
+// WaitForInputs blocks until at least n inputs were received or the
+// timeout is reached and returns the inputs received
+func (s *Server) WaitForInputs(n int, timeout time.Duration) ([]Input, error) {
+	var inputs []Input
+
+	ok := s.waitFor(timeout, func() bool {
+		inputs = append([]Input(nil), s.inputs...)
+		return len(inputs) >= n
+	})
+	if !ok {
+		return inputs, errors.Errorf("Received %d of %d inputs", len(inputs), n)
+	}
+
+	return inputs, nil
+}
+
+// WaitForSession blocks until a client is logged in or the timeout is
+// reached
+func (s *Server) WaitForSession(timeout time.Duration) error {
+	if !s.waitFor(timeout, func() bool { return len(s.sessions) > 0 }) {
+		return errors.New("No client logged in")
+	}
+
+	return nil
+}
+
+// waitFor blocks until the condition, which is checked with the lock
+// held, is met and returns false if the timeout was reached before
+func (s *Server) waitFor(timeout time.Duration, cond func() bool) bool {
+	var timedOut bool
+
+	timer := time.AfterFunc(timeout, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		timedOut = true
+		s.changed.Broadcast()
+	})
+	defer timer.Stop()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for !cond() {
+		if timedOut {
+			return false
+		}
+		s.changed.Wait()
+	}
+
+	return true
+}
+
+func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(r.URL.Query().Get("EIO"))
+	if err != nil || (version != sioclient.EIOVersion3 && version != sioclient.EIOVersion4) {
+		http.Error(w, "unsupported EIO version", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("transport") != sioclient.TransportWebsocket {
+		http.Error(w, "only websocket transport is supported", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	c := &conn{server: s, version: version, ws: ws}
+	defer s.setSession(c, false)
+	c.serve()
+}
+
+// login validates the credentials and returns the token of the session
+// or an empty string for failed logins
+func (s *Server) login(user, password, token string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if token != "" {
+		s.logins = append(s.logins, LoginToken)
+		return token, user == s.User && s.tokens[token]
+	}
+
+	s.logins = append(s.logins, LoginPassword)
+	if user != s.User || password != s.Password {
+		return "", false
+	}
+
+	s.lastToken++
+	token = "token-" + strconv.Itoa(s.lastToken)
+	s.tokens[token] = true
+
+	return token, true
+}
+
+func (s *Server) channel(id int) *Channel {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, n := range s.Networks {
+		for _, c := range n.Channels {
+			if c.ID == id {
+				return &c
+			}
+		}
+	}
+
+	return nil
+}
+
+// execute runs the join, part or topic command in the input and returns the
+// event and its payload to send to the client
+func (s *Server) execute(in Input) (string, interface{}) {
+	fields := strings.Fields(in.Text)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(fields) < 2 || s.Unresponsive {
+		return "", nil
+	}
+
+	var (
+		network *Network
+		nextID  int
+	)
+	for i := range s.Networks {
+		for _, c := range s.Networks[i].Channels {
+			if c.ID == in.Target {
+				network = &s.Networks[i]
+			}
+			if c.ID >= nextID {
+				nextID = c.ID + 1
+			}
+		}
+	}
+
+	if network == nil {
+		return "", nil
+	}
+
+	var (
+		name    = fields[1]
+		present = -1
+	)
+	for i, c := range network.Channels {
+		if strings.EqualFold(c.Name, name) {
+			present = i
+		}
+	}
+
+	ircError := func(code string) (string, interface{}) {
+		return "msg", map[string]interface{}{
+			"chan": in.Target,
+			"msg": map[string]interface{}{
+				"type":    "error",
+				"error":   code,
+				"channel": name,
+				"reason":  "Cannot execute " + fields[0],
+			},
+		}
+	}
+
+	switch fields[0] {
+
+	case "/join":
+		if code, ok := s.JoinErrors[name]; ok {
+			return ircError(code)
+		}
+
+		if present >= 0 {
+			ch := &network.Channels[present]
+			if ch.State == ChannelJoined {
+				// The IRC server does not echo joins of channels the
+				// user is already in
+				return "", nil
+			}
+
+			ch.State = ChannelJoined
+			return "channel:state", map[string]interface{}{"chan": ch.ID, "state": ch.State}
+		}
+
+		ch := Channel{ID: nextID, Name: name, Type: "channel", State: ChannelJoined}
+		network.Channels = append(network.Channels, ch)
+		return "join", map[string]interface{}{"network": network.UUID, "chan": ch, "index": len(network.Channels) - 1}
+
+	case "/topic":
+		for i := range network.Channels {
+			if network.Channels[i].ID == in.Target && network.Channels[i].Type == "channel" {
+				network.Channels[i].Topic = strings.TrimPrefix(in.Text, "/topic ")
+				return "topic", map[string]interface{}{"chan": in.Target, "topic": network.Channels[i].Topic}
+			}
+		}
+
+	case "/part":
+		if present < 0 {
+			return ircError("not_on_channel")
+		}
+
+		id := network.Channels[present].ID
+		network.Channels = append(network.Channels[:present], network.Channels[present+1:]...)
+		return "part", map[string]interface{}{"chan": id}
+
+	}
+
+	return "", nil
+}
+
+// networks returns a copy of the networks for the "init" event
+func (s *Server) networks() []Network {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	networks := append([]Network(nil), s.Networks...)
+	for i := range networks {
+		networks[i].Channels = append([]Channel(nil), networks[i].Channels...)
+	}
+
+	return networks
+}
+
+func (s *Server) unresponsive() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.Unresponsive
+}
+
+func (s *Server) recordInput(in Input) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.inputs = append(s.inputs, in)
+	s.changed.Broadcast()
+}
+
+func (s *Server) setSession(c *conn, active bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if active {
+		s.sessions[c] = true
+	} else {
+		delete(s.sessions, c)
+	}
+	s.changed.Broadcast()
+}
+
+// conn executes the server side of a single client connection
+type conn struct {
+	server  *Server
+	token   string
+	version int
+	ws      *websocket.Conn
+
+	writeLock sync.Mutex
+}
+
+func (c *conn) serve() {
+	c.write(`0{"sid":"loungetest","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`)
+
+	if c.version == sioclient.EIOVersion3 {
+		// Socket.IO v2 connects the client to the default namespace and
+		// TheLounge starts the authentication right away
+		c.write("40")
+		c.emit("auth:start", 1)
+	}
+
+	var decoder sioclient.Decoder
+	for {
+		_, frame, err := c.ws.ReadMessage()
+		if err != nil || len(frame) == 0 {
+			return
+		}
+
+		switch frame[0] {
+
+		case '1':
+			// Client closes the session
+			return
+
+		case '2':
+			c.write("3" + string(frame[1:]))
+
+		case '4':
+			msg, err := decoder.DecodeText(frame[1:])
+			if err != nil || msg == nil {
+				continue
+			}
+			c.handleMessage(msg)
+
+		}
+	}
+}
+
+func (c *conn) emit(event string, data interface{}) {
+	msg, err := sioclient.NewMessage(sioclient.MessageTypeEvent, 0, event, data)
+	if err != nil {
+		return
+	}
+
+	raw, err := msg.Encode()
+	if err != nil {
+		return
+	}
+
+	c.write("4" + raw)
+}
+
+func (c *conn) handleMessage(msg *sioclient.Message) {
+	if msg.Type == sioclient.MessageTypeConnect {
+		// Socket.IO v3+ requires the client to connect the namespace
+		c.write(`40{"sid":"loungetest"}`)
+		c.emit("auth:start", 1)
+		return
+	}
+
+	if msg.Type != sioclient.MessageTypeEvent {
+		return
+	}
+
+	event, err := msg.PayloadType()
+	if err != nil {
+		return
+	}
+
+	switch event {
+
+	case "auth:perform":
+		var creds struct {
+			User     string `json:"user"`
+			Password string `json:"password"`
+			Token    string `json:"token"`
+		}
+		if msg.UnmarshalPayload(&creds) != nil {
+			c.emit("auth:failed", nil)
+			return
+		}
+
+		token, ok := c.server.login(creds.User, creds.Password, creds.Token)
+		if !ok {
+			c.emit("auth:failed", nil)
+			return
+		}
+		c.token = token
+
+		init := map[string]interface{}{
+			"active":   -1,
+			"networks": c.server.networks(),
+		}
+		if creds.Token == "" {
+			// New sessions are announced to the client
+			init["token"] = token
+		}
+		c.emit("init", init)
+		c.server.setSession(c, true)
+
+	case "sign-out":
+		c.server.lock.Lock()
+		delete(c.server.tokens, c.token)
+		c.server.lock.Unlock()
+
+		c.emit("sign-out", nil)
+
+	case "more":
+		var req struct {
+			Target int `json:"target"`
+			LastID int `json:"lastId"`
+		}
+		if msg.UnmarshalPayload(&req) != nil {
+			return
+		}
+
+		ch := c.server.channel(req.Target)
+		if ch == nil || c.server.unresponsive() {
+			return
+		}
+
+		for i, m := range ch.History {
+			if m.ID == req.LastID {
+				// TheLounge does not answer requests for unknown messages
+				c.emit("more", map[string]interface{}{
+					"chan":          ch.ID,
+					"messages":      historyPage(ch.History, i),
+					"totalMessages": len(ch.History),
+				})
+				return
+			}
+		}
+
+	case "input":
+		var in Input
+		if msg.UnmarshalPayload(&in) != nil {
+			return
+		}
+
+		c.server.recordInput(in)
+		if event, data := c.server.execute(in); event != "" {
+			c.emit(event, data)
+		}
+
+	}
+}
+
+func (c *conn) write(frame string) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.ws.WriteMessage(websocket.TextMessage, []byte(frame))
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/Luzifer/lounge-control/sioclient"
@@ -14,25 +17,74 @@ import (
 
 var (
 	cfg = struct {
-		LogLevel       string `flag:"log-level" default:"info" description:"Log level (debug, info, warn, error, fatal)"`
-		Network        string `flag:"network,n" description:"Name or UUID of the network to act on"`
-		Password       string `flag:"password,p" description:"Password for the given username" validate:"nonzero"`
-		SocketURL      string `flag:"socket-url" description:"URL to TheLounge websocket (i.e. 'wss://example.com/socket.io/')" validate:"nonzero"`
-		Username       string `flag:"username,u" description:"Username to log into the socket" validate:"nonzero"`
-		VersionAndExit bool   `flag:"version" default:"false" description:"Prints current version and exits"`
+		Config                string        `flag:"config" description:"Config file with connection profiles (defaults to lounge-control/config.yml in the user config directory)"`
+		Cookies               []string      `flag:"cookie" vardefault:"cookie" description:"Cookie to send to the server (name=value, repeatable)"`
+		DryRun                bool          `flag:"dry-run" vardefault:"dry-run" default:"false" description:"Print the plan of joins, parts and messages instead of sending them (apply, join, part, send, sync commands)"`
+		EIOVersion            int           `flag:"eio-version" vardefault:"eio-version" default:"3" description:"Engine.IO protocol version of the server (3 = TheLounge with Socket.IO 2, 4 = Socket.IO 3+)"`
+		File                  string        `flag:"file,f" vardefault:"file" description:"Channel state file to apply (apply)"`
+		Force                 bool          `flag:"force" vardefault:"force" default:"false" description:"Part channels even if exceeding the part limit"`
+		HandshakeTimeout      time.Duration `flag:"handshake-timeout" vardefault:"handshake-timeout" default:"10s" description:"Timeout to establish a connection to the server (0 = no timeout)"`
+		Headers               []string      `flag:"header" vardefault:"header" description:"Header to send to the server (Name: value, repeatable)"`
+		HighlightsOnly        bool          `flag:"highlights-only" vardefault:"highlights-only" default:"false" description:"Only show messages highlighting you (tail, history)"`
+		Limit                 int           `flag:"limit" vardefault:"limit" default:"0" description:"Maximum number of messages to fetch (history, 0 = unlimited)"`
+		LogLevel              string        `flag:"log-level" vardefault:"log-level" default:"info" description:"Log level (debug, info, warn, error, fatal)"`
+		MessageTypes          []string      `flag:"type" vardefault:"type" description:"Only show messages of these types (tail, history: message, notice, action, join, part, ...)"`
+		Network               string        `flag:"network,n" vardefault:"network" description:"Name or UUID of the network to act on"`
+		Output                string        `flag:"output,o" vardefault:"output" default:"text" description:"Output format (text, json, jsonl, yaml, table, csv, template=<Go template>)"`
+		PartLimit             string        `flag:"part-limit" vardefault:"part-limit" default:"25%" description:"Maximum number or percentage of channels to part in one sync (empty = unlimited)"`
+		Password              string        `flag:"password,p" vardefault:"password" description:"Password for the given username (prefer the other password sources, see README)"`
+		PasswordCommand       string        `flag:"password-command" vardefault:"password-command" description:"Command to execute to get the password from its first line of output (i.e. 'pass show lounge')"`
+		PasswordFile          string        `flag:"password-file" vardefault:"password-file" description:"File to read the password from"`
+		PasswordStdin         bool          `flag:"password-stdin" vardefault:"password-stdin" default:"false" description:"Read the password from the first line of stdin"`
+		Profile               string        `flag:"profile" description:"Profile from the config file to use (defaults to the default_profile of the file or 'default')"`
+		Proxy                 string        `flag:"proxy" vardefault:"proxy" description:"Proxy to connect through (http://, https:// or socks5:// URL, defaults to HTTP_PROXY / HTTPS_PROXY)"`
+		Prune                 bool          `flag:"prune" vardefault:"prune" default:"false" description:"Part channels not listed in the channel state file (apply)"`
+		ReconnectAttempts     int           `flag:"reconnect-attempts" vardefault:"reconnect-attempts" default:"5" description:"How often to try reconnecting a lost connection (0 = disable, -1 = forever)"`
+		ReconnectBackoff      time.Duration `flag:"reconnect-backoff" vardefault:"reconnect-backoff" default:"500ms" description:"Initial delay between reconnect attempts, doubled on every attempt"`
+		Since                 string        `flag:"since" vardefault:"since" description:"Fetch messages newer than this duration or RFC3339 time (history)"`
+		SocketURL             string        `flag:"socket-url" vardefault:"socket-url" description:"URL to TheLounge websocket (i.e. 'wss://example.com/socket.io/')" validate:"nonzero"`
+		StateFile             string        `flag:"state-file" vardefault:"state-file" description:"File to store session tokens in (defaults to lounge-control/state.json in the user config directory)"`
+		TLSCAFile             string        `flag:"tls-ca-file" vardefault:"tls-ca-file" description:"PEM file with CA certificates to trust in addition to the system ones"`
+		TLSClientCert         string        `flag:"tls-client-cert" vardefault:"tls-client-cert" description:"PEM file with a client certificate to present to the server"`
+		TLSClientKey          string        `flag:"tls-client-key" vardefault:"tls-client-key" description:"PEM file with the key of the client certificate"`
+		TLSInsecureSkipVerify bool          `flag:"tls-insecure-skip-verify" vardefault:"tls-insecure-skip-verify" default:"false" description:"Do not verify the certificate of the server (dangerous!)"`
+		Timeout               time.Duration `flag:"timeout" vardefault:"timeout" default:"10s" description:"Time to wait for the server to confirm joins and parts or to send a history page and for sync providers to return the channels"`
+		Transport             string        `flag:"transport" vardefault:"transport" default:"websocket" description:"Transport to connect with (websocket, polling)"`
+		TwitchClientID        string        `flag:"twitch-client-id" vardefault:"twitch-client-id" description:"Client ID of the Twitch application to use for the Twitch API"`
+		TwitchClientSecret    string        `flag:"twitch-client-secret" vardefault:"twitch-client-secret" description:"Client secret of the Twitch application (only for confidential clients)"`
+		Upgrade               bool          `flag:"upgrade" vardefault:"upgrade" default:"true" description:"Upgrade polling connections to websocket if possible"`
+		Username              string        `flag:"username,u" vardefault:"username" description:"Username to log into the socket" validate:"nonzero"`
+		VersionAndExit        bool          `flag:"version" default:"false" description:"Prints current version and exits"`
 	}{}
 
-	client    *sioclient.Client
-	initData  initMessage
-	interrupt = make(chan os.Signal, 1)
+	client   *sioclient.Client
+	initData initMessage
+	state    *appState
+	stdout   io.Writer = os.Stdout
+
+	// Commands signal completion through interrupt or fail after the
+	// fact (i.e. when confirmations timed out) through commandErrors
+	commandErrors = make(chan error, 1)
+	interrupt     = make(chan os.Signal, 1)
 
 	version = "dev"
 )
 
-func init() {
+func initApp() {
 	rconfig.AutoEnv(true)
+	if err := loadConfigFile(os.Args[1:]); err != nil {
+		log.WithError(err).Error("Unable to load config file")
+		os.Exit(exitUsage)
+	}
+
 	if err := rconfig.ParseAndValidate(&cfg); err != nil {
-		log.Fatalf("Unable to parse commandline options: %s", err)
+		log.WithError(err).Error("Unable to parse commandline options")
+		os.Exit(exitUsage)
+	}
+
+	if err := validatePasswordSources(); err != nil {
+		log.WithError(err).Error("Unable to validate commandline options")
+		os.Exit(exitUsage)
 	}
 
 	if cfg.VersionAndExit {
@@ -41,47 +93,121 @@ func init() {
 	}
 
 	if l, err := log.ParseLevel(cfg.LogLevel); err != nil {
-		log.WithError(err).Fatal("Unable to parse log level")
+		log.WithError(err).Error("Unable to parse log level")
+		os.Exit(exitUsage)
 	} else {
 		log.SetLevel(l)
 	}
 }
 
 func main() {
+	initApp()
 	signal.Notify(interrupt, os.Interrupt)
 
-	args := rconfig.Args()[1:]
+	if err := run(rconfig.Args()[1:]); err != nil {
+		log.WithError(err).Error("Error in command / socket")
+		os.Exit(exitCode(err))
+	}
+}
+
+// run connects to the server and executes the command given in the
+// arguments until it signals completion through the interrupt channel
+// or reports an error through commandErrors
+func run(args []string) error {
 	if len(args) == 0 {
-		log.Fatalf("No command given. Available commands: %s", strings.Join(availableCommands(), ", "))
+		return usageErrorf("No command given. Available commands: %s", strings.Join(availableCommands(), ", "))
 	}
 
 	commandsMutex.RLock()
 	cf, ok := commands[args[0]]
 	commandsMutex.RUnlock()
 	if !ok {
-		log.Fatalf("Unknown command %q. Available commands: %s", args[0], strings.Join(availableCommands(), ", "))
+		return usageErrorf("Unknown command %q. Available commands: %s", args[0], strings.Join(availableCommands(), ", "))
+	}
+
+	sioConfig := sioclient.Config{
+		EIOVersion: cfg.EIOVersion,
+		Reconnect: sioclient.ReconnectConfig{
+			Attempts:   cfg.ReconnectAttempts,
+			BackoffMin: cfg.ReconnectBackoff,
+		},
+		StateHandler: logConnectionState,
+		Transport:    cfg.Transport,
+		Upgrade:      cfg.Upgrade,
+		URL:          cfg.SocketURL,
+	}
+
+	if err := applyDialerOptions(&sioConfig); err != nil {
+		return errors.Wrap(err, "Unable to configure connection")
 	}
 
 	var err error
-	client, err = sioclient.New(sioclient.Config{
-		MessageHandler: cf(args[1:]),
-		URL:            cfg.SocketURL,
-	})
+	if output, err = parseOutputFormat(cfg.Output); err != nil {
+		return err
+	}
+
+	if state, err = loadState(); err != nil {
+		return errors.Wrap(err, "Unable to load state")
+	}
+
+	passwordCache = nil
+	if state.Token() == "" {
+		// Ask for the password before connecting as prompting in the
+		// login handler blocks the connection
+		if _, err = password(); err != nil {
+			return err
+		}
+	}
+
+	client, err = sioclient.NewClient(sioConfig)
 	if err != nil {
-		log.WithError(err).Fatal("Unable to connect to server")
+		return errors.Wrap(err, "Unable to create client")
+	}
+
+	registerGenericHandlers()
+	if err = cf(args[1:]); err != nil {
+		return errors.Wrapf(err, "Unable to execute command %q", args[0])
+	}
+
+	if err = client.Dial(); err != nil {
+		return connectionError{errors.Wrap(err, "Unable to connect to server")}
 	}
-	defer client.Close()
+	defer func() {
+		client.Close()
+		<-client.Done()
+	}()
 
 	for {
 		select {
 
 		case <-interrupt:
-			return
+			return nil
+
+		case err := <-commandErrors:
+			return errors.Wrapf(err, "Unable to execute command %q", args[0])
 
 		case err := <-client.EIO.Errors():
-			log.WithError(err).Error("Error in in command / socket")
-			return
+			if _, ok := errors.Cause(err).(sioclient.PingTimeoutError); ok && cfg.ReconnectAttempts != 0 {
+				// Dead connection has been closed and is going to be redialed
+				log.WithError(err).Warn("Connection to server timed out")
+				continue
+			}
+
+			return err
 
 		}
 	}
 }
+
+func logConnectionState(state sioclient.ConnectionState) {
+	logger := log.WithField("state", state)
+
+	switch state {
+	case sioclient.ConnectionStateReconnecting:
+		logger.Warn("Connection to server lost, reconnecting")
+	case sioclient.ConnectionStateGaveUp:
+		logger.Error("Unable to reconnect to server")
+	default:
+		logger.Debug("Connection state changed")
+	}
+}
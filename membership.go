@@ -0,0 +1,511 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// channelStateJoined is the state TheLounge reports in "channel:state"
+// events for channels the user is in
+const channelStateJoined = 1
+
+// membershipChange executes the steps of a plan (joins, parts and
+// topic changes) and waits for the server to confirm every one of them
+// by the matching event or to reject it by an error message
+type membershipChange struct {
+	// delay is waited between sending two inputs for servers limiting
+	// the rate of commands
+	delay time.Duration
+	name  string
+	plan  func(init initMessage) ([]planStep, error)
+
+	finished bool
+	// init is the "init" event of the current session the steps are
+	// resolved with
+	init initMessage
+	// notFound contains the errors of steps failed for unknown channels
+	// which determine the exit code if no other step failed
+	notFound []error
+	// channels maps the IDs of all known channels to their key in
+	// pending as parts and topics are confirmed by the channel ID
+	channels map[int]string
+	// deferred contains steps for channels joined by an earlier step
+	// which are sent after the join was confirmed
+	deferred map[string]*pendingStep
+	pending  map[string]*pendingStep
+	results  []*actionResult
+	timer    *time.Timer
+	lock     sync.Mutex
+}
+
+type pendingStep struct {
+	action string
+	// input is the text sent for deferred steps
+	input  string
+	result *actionResult
+}
+
+// registerMembershipChange registers the handlers executing the plan
+// created after the "init" event on the client. The name is used to
+// report failures.
+func registerMembershipChange(name string, plan func(init initMessage) ([]planStep, error)) *membershipChange {
+	m := &membershipChange{name: name, plan: plan, channels: map[int]string{}}
+
+	onInit(m.start, m.resume)
+	client.On("channel:state", m.handleState)
+	client.On("join", m.handleJoin)
+	client.On("msg", m.handleMessage)
+	client.On("part", m.handlePart)
+	client.On("topic", m.handleTopic)
+
+	return m
+}
+
+// channelSteps returns a plan function executing the step created by
+// the given function for every channel in the network selected by the
+// --network flag
+func channelSteps(channels []string, step func(network, channel string) planStep) func(init initMessage) ([]planStep, error) {
+	return func(init initMessage) ([]planStep, error) {
+		network, err := init.FindNetwork(cfg.Network)
+		if err != nil {
+			return nil, err
+		}
+
+		var steps []planStep
+		for _, ch := range channels {
+			steps = append(steps, step(network.Name, channelName(ch)))
+		}
+
+		return steps, nil
+	}
+}
+
+// start executes the plan off the read loop as planning might need to
+// fetch the channels from slow sources (i.e. sync providers) during
+// which the connection would miss its heartbeat
+func (m *membershipChange) start() error {
+	m.lock.Lock()
+	m.init = initData
+	init := m.init
+	m.lock.Unlock()
+
+	go func() {
+		if err := m.execute(init); err != nil {
+			commandErrors <- err
+		}
+	}()
+
+	return nil
+}
+
+// execute plans the steps using the given "init" event and sends their
+// inputs, or prints them in dry-run mode
+func (m *membershipChange) execute(init initMessage) error {
+	steps, err := m.plan(init)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			m.lock.Unlock()
+		}
+	}()
+
+	// The session might have been resumed while planning
+	for _, n := range m.init.Networks {
+		for _, c := range n.Channels {
+			m.channels[c.ID] = pendingKey(n.UUID, c.Name)
+		}
+	}
+	m.deferred = map[string]*pendingStep{}
+	m.pending = map[string]*pendingStep{}
+
+	if cfg.DryRun {
+		var (
+			joins = map[string]bool{}
+			plan  []planStep
+		)
+		for _, step := range steps {
+			if key, ok := m.awaitsJoin(step, joins); ok {
+				// Topic of a channel joined by an earlier step
+				joins[key] = false
+				plan = append(plan, step)
+				continue
+			}
+
+			network, _, err := m.stepTarget(step)
+			if err != nil {
+				log.WithField("channel", step.Target).Warnf("Channel would not be changed: %s", err)
+				continue
+			}
+			switch {
+			case m.alreadyJoined(step):
+				step = planStep{Op: planRetain, Action: "retain", Network: step.Network, Target: step.Target}
+			case step.Action == "join":
+				joins[pendingKey(network.UUID, step.Target)] = true
+			}
+			plan = append(plan, step)
+		}
+
+		m.finished = true
+		return printPlan(plan)
+	}
+
+	type input struct {
+		text   string
+		target int
+	}
+
+	var (
+		inputs []input
+		joins  = map[string]bool{}
+	)
+	for _, step := range steps {
+		if step.Op == planRetain {
+			continue
+		}
+
+		result := &actionResult{Action: step.Action, Network: step.Network, Target: step.Target}
+		m.results = append(m.results, result)
+
+		if key, ok := m.awaitsJoin(step, joins); ok {
+			// The channel does not exist before the join is confirmed
+			joins[key] = false
+			m.deferred[key] = &pendingStep{action: step.Action, input: step.text(), result: result}
+			continue
+		}
+
+		network, target, err := m.stepTarget(step)
+		if err != nil {
+			result.Error = err.Error()
+			if _, ok := errors.Cause(err).(channelNotFoundError); ok {
+				m.notFound = append(m.notFound, err)
+			}
+			continue
+		}
+
+		if m.alreadyJoined(step) {
+			// IRC servers do not confirm joins of channels the user is in
+			log.WithField("channel", step.Target).Debug("Channel is already joined")
+			continue
+		}
+
+		key := pendingKey(network.UUID, step.Target)
+		inputs = append(inputs, input{text: step.text(), target: target})
+		m.pending[key] = &pendingStep{action: step.Action, result: result}
+		joins[key] = step.Action == "join"
+	}
+
+	if len(m.pending) == 0 {
+		m.finish()
+		return nil
+	}
+
+	// Confirmations are handled while sending which might take a while
+	// for throttled inputs
+	m.lock.Unlock()
+	locked = false
+
+	for i, in := range inputs {
+		if i > 0 {
+			time.Sleep(m.delay)
+		}
+
+		if err := client.Emit("input", map[string]interface{}{
+			"text":   in.text,
+			"target": in.target,
+		}); err != nil {
+			return errors.Wrap(err, "Unable to send input")
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.startTimer()
+	return nil
+}
+
+// resume updates the channel IDs from the "init" event of a session
+// resumed after a reconnect without executing the plan again. Joins and
+// parts whose confirmation was lost with the connection are resolved
+// by the state of the channels.
+func (m *membershipChange) resume() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.init = initData
+
+	joined := map[string]bool{}
+	for _, n := range m.init.Networks {
+		for _, c := range n.Channels {
+			key := pendingKey(n.UUID, c.Name)
+			m.channels[c.ID] = key
+			joined[key] = c.State == channelStateJoined
+		}
+	}
+
+	for key, step := range m.pending {
+		isJoined, present := joined[key]
+		if (step.action == "join" && isJoined) || (step.action == "part" && !present) {
+			m.resolve(key, step.action, "")
+		}
+	}
+
+	return nil
+}
+
+// startTimer starts waiting for the confirmations after all inputs were
+// sent. The lock must be held when calling.
+func (m *membershipChange) startTimer() {
+	if m.finished {
+		return
+	}
+
+	m.timer = time.AfterFunc(cfg.Timeout, func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		m.finish()
+	})
+}
+
+// stepTarget returns the network of the step and the ID of the channel
+// to send its input to: the channel itself for topic changes and the
+// lobby otherwise
+func (m *membershipChange) stepTarget(step planStep) (*network, int, error) {
+	network, err := m.init.FindNetwork(step.Network)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	channel, err := network.FindChannel(step.Target)
+	switch {
+	case err != nil && (step.Action == "part" || step.Action == "topic"):
+		return nil, 0, err
+	case step.Action == "topic":
+		return network, channel.ID, nil
+	}
+
+	lobby, err := network.Lobby()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return network, lobby.ID, nil
+}
+
+// awaitsJoin reports whether the step changes the topic of a channel
+// joined by an earlier step of the plan. The joins map the channels to
+// whether a step still waits for their join.
+func (m *membershipChange) awaitsJoin(step planStep, joins map[string]bool) (string, bool) {
+	if step.Action != "topic" {
+		return "", false
+	}
+
+	network, err := m.init.FindNetwork(step.Network)
+	if err != nil {
+		return "", false
+	}
+
+	key := pendingKey(network.UUID, step.Target)
+	return key, joins[key]
+}
+
+// alreadyJoined reports whether the step joins a channel the user is
+// already in according to the "init" event
+func (m *membershipChange) alreadyJoined(step planStep) bool {
+	if step.Action != "join" {
+		return false
+	}
+
+	network, err := m.init.FindNetwork(step.Network)
+	if err != nil {
+		return false
+	}
+
+	channel, err := network.FindChannel(step.Target)
+	return err == nil && channel.Type == "channel" && channel.State == channelStateJoined
+}
+
+// handleJoin confirms joins of channels new to the network
+func (m *membershipChange) handleJoin(data struct {
+	Network string  `json:"network"`
+	Chan    channel `json:"chan"`
+}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := pendingKey(data.Network, data.Chan.Name)
+	m.channels[data.Chan.ID] = key
+	m.resolve(key, "join", "")
+}
+
+// handleMessage rejects channels the server reported an error for, i.e.
+// "banned_from_channel", "invite_only_channel", "bad_channel_key" or
+// "channel_is_full"
+func (m *membershipChange) handleMessage(data chatMessage) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key, ok := m.channels[data.Chan]
+	if !ok || data.Msg.Type != "error" || data.Msg.Channel == "" {
+		return
+	}
+
+	reason := data.Msg.Error
+	if data.Msg.Reason != "" {
+		reason = fmt.Sprintf("%s (%s)", data.Msg.Error, data.Msg.Reason)
+	}
+
+	// The error is reported in a channel of the same network
+	m.resolve(pendingKey(strings.SplitN(key, "/", 2)[0], data.Msg.Channel), "", reason)
+}
+
+// handlePart confirms parts of channels
+func (m *membershipChange) handlePart(data struct {
+	Chan int `json:"chan"`
+}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.resolve(m.channels[data.Chan], "part", "")
+}
+
+// handleState confirms joins of channels known to the network but not
+// joined (i.e. after being kicked) which are not announced by a "join"
+// event
+func (m *membershipChange) handleState(data struct {
+	Chan  int `json:"chan"`
+	State int `json:"state"`
+}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if data.State == channelStateJoined {
+		m.resolve(m.channels[data.Chan], "join", "")
+	}
+}
+
+// handleTopic confirms topic changes
+func (m *membershipChange) handleTopic(data struct {
+	Chan int `json:"chan"`
+}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.resolve(m.channels[data.Chan], "topic", "")
+}
+
+// resolve marks the step for the channel as confirmed or as failed if a
+// reason is given and finishes the change when no step is pending
+// anymore. Without action the step is resolved regardless of its
+// action. The lock must be held when calling.
+func (m *membershipChange) resolve(key, action, reason string) {
+	step, ok := m.pending[key]
+	if !ok || m.finished || (action != "" && step.action != action) {
+		return
+	}
+
+	step.result.Error = reason
+	delete(m.pending, key)
+
+	if next, ok := m.deferred[key]; ok {
+		delete(m.deferred, key)
+		m.sendDeferred(key, next, reason == "")
+	}
+
+	if len(m.pending) == 0 {
+		m.finish()
+	}
+}
+
+// sendDeferred sends the input of the step waiting for the join of its
+// channel and marks it pending. The lock must be held when calling.
+func (m *membershipChange) sendDeferred(key string, step *pendingStep, joined bool) {
+	if !joined {
+		step.result.Error = "not joined"
+		return
+	}
+
+	for id, k := range m.channels {
+		if k != key {
+			continue
+		}
+
+		if err := client.Emit("input", map[string]interface{}{
+			"text":   step.input,
+			"target": id,
+		}); err != nil {
+			step.result.Error = err.Error()
+			return
+		}
+
+		m.pending[key] = step
+		return
+	}
+
+	step.result.Error = "not joined"
+}
+
+// finish prints the results and ends the command, steps still pending
+// are reported as timed out. The lock must be held when calling.
+func (m *membershipChange) finish() {
+	if m.finished {
+		return
+	}
+	m.finished = true
+
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+
+	for _, step := range m.pending {
+		step.result.Error = "timed out"
+	}
+	for _, step := range m.deferred {
+		step.result.Error = "timed out"
+	}
+
+	var (
+		failed  int
+		results []actionResult
+	)
+	for _, r := range m.results {
+		if r.Error != "" {
+			failed++
+		}
+		results = append(results, *r)
+	}
+
+	if err := printResults(results); err != nil {
+		commandErrors <- err
+		return
+	}
+
+	switch {
+	case failed > 0 && failed == len(m.notFound):
+		commandErrors <- errors.Wrapf(m.notFound[0], "Unable to %s %d of %d channels", m.name, failed, len(results))
+		return
+	case failed > 0:
+		commandErrors <- errors.Errorf("Unable to %s %d of %d channels", m.name, failed, len(results))
+		return
+	}
+
+	interrupt <- os.Interrupt
+}
+
+// pendingKey identifies a channel by the UUID of its network and its
+// case insensitive name
+func pendingKey(networkUUID, channel string) string {
+	return networkUUID + "/" + strings.ToLower(channel)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Luzifer/lounge-control/loungetest"
+)
+
+func TestMembershipConfirmation(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	srv.JoinErrors = map[string]string{"#evil": "banned_from_channel"}
+	srv.Networks[0].Channels = append(srv.Networks[0].Channels, loungetest.Channel{ID: 5, Name: "#kicked", Type: "channel"})
+
+	// #foo is already joined and not sent, #kicked is known but not
+	// joined and confirmed by its state
+	out, err := runCommand(t, srv, "Libera", "join", "baz", "#evil", "FOO", "kicked")
+	if err == nil || !strings.Contains(err.Error(), "Unable to join 1 of 4 channels") {
+		t.Errorf("Expected failed join to be reported, got %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"join #baz",
+		"join #evil failed: banned_from_channel (Cannot execute /join)",
+		"join #FOO",
+		"join #kicked",
+	}, "\n") + "\n"
+	if out != expected {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	// Parting the joined channel succeeds, unknown ones are not sent
+	out, err = runCommand(t, srv, "Libera", "part", "baz", "unknown")
+	if err == nil || !strings.Contains(err.Error(), "Unable to part 1 of 2 channels") {
+		t.Errorf("Expected failed part to be reported, got %v", err)
+	}
+
+	// All failures were unknown channels
+	if code := exitCode(err); code != exitChannelNotFound {
+		t.Errorf("Expected exit code %d, got %d", exitChannelNotFound, code)
+	}
+
+	if expected := "part #baz\npart #unknown failed: Channel \"#unknown\" not found in network \"Libera\"\n"; out != expected {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	if inputs := srv.Inputs(); len(inputs) != 4 || inputs[2].Text != "/join #kicked" || inputs[3].Text != "/part #baz" {
+		t.Errorf("Unexpected inputs: %+v", inputs)
+	}
+}
+
+func TestMembershipResumed(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	enableReconnect(t)
+	srv.Unresponsive = true
+
+	defer func() { cfg.Timeout = 0 }()
+	cfg.Timeout = 500 * time.Millisecond
+
+	buf, errC := startCommand(t, srv, "Libera", "join", "newchan")
+
+	// Connection is lost after the join was sent
+	if _, err := srv.WaitForInputs(1, time.Second); err != nil {
+		t.Fatalf("Join was not sent: %s", err)
+	}
+	srv.DropSessions()
+
+	err := <-errC
+	if err == nil || !strings.Contains(err.Error(), "Unable to join 1 of 1 channels") {
+		t.Errorf("Expected timeout to be reported, got %v", err)
+	}
+
+	if expected := "join #newchan failed: timed out\n"; buf.String() != expected {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+
+	if logins := srv.Logins(); len(logins) != 2 {
+		t.Errorf("Expected session to be resumed, got logins %v", logins)
+	}
+
+	// The join must not be sent again on the resumed session
+	if inputs := srv.Inputs(); len(inputs) != 1 {
+		t.Errorf("Unexpected inputs: %+v", inputs)
+	}
+}
+
+func TestMembershipTimeout(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	srv.Unresponsive = true
+
+	defer func() { cfg.Timeout = 0 }()
+	cfg.Timeout = 100 * time.Millisecond
+
+	out, err := runCommand(t, srv, "Libera", "join", "baz")
+	if err == nil || !strings.Contains(err.Error(), "Unable to join 1 of 1 channels") {
+		t.Errorf("Expected timeout to be reported, got %v", err)
+	}
+
+	if expected := "join #baz failed: timed out\n"; out != expected {
+		t.Errorf("Unexpected output: %q", out)
+	}
+}
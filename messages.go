@@ -1,9 +1,20 @@
 package main
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
 
 type chatMessageContent struct {
+	// Channel, Error and Reason are set on "error" messages caused by
+	// IRC error numerics
+	Channel string `json:"channel"`
 	Command string `json:"command"`
+	Error   string `json:"error"`
 	From    struct {
 		Mode string `json:"mode"`
 		Nick string `json:"nick"`
@@ -12,6 +23,7 @@ type chatMessageContent struct {
 	ID        int           `json:"id"`
 	Params    []string      `json:"params"`
 	Previews  []interface{} `json:"previews"`
+	Reason    string        `json:"reason"`
 	Self      bool          `json:"self"`
 	Text      string        `json:"text"`
 	Time      time.Time     `json:"time"`
@@ -56,12 +68,52 @@ type network struct {
 	} `json:"status"`
 }
 
+// FindChannel returns the channel with the given name, "lobby" selects
+// the lobby of the network
+func (n network) FindChannel(name string) (*channel, error) {
+	for _, c := range n.Channels {
+		if (name == "lobby" && c.Type == "lobby") || strings.EqualFold(name, c.Name) {
+			return &c, nil
+		}
+	}
+
+	return nil, channelNotFoundError{Channel: name, Network: n.Name}
+}
+
+// Lobby returns the lobby of the network which commands not bound to a
+// channel are sent to
+func (n network) Lobby() (*channel, error) {
+	for _, c := range n.Channels {
+		if c.Type == "lobby" {
+			return &c, nil
+		}
+	}
+
+	return nil, errors.New("Unable to find lobby for network")
+}
+
 type initMessage struct {
 	Active   int       `json:"active"`
 	Networks []network `json:"networks"`
 	Token    string    `json:"token"`
 }
 
+// FindNetwork returns the network with the given name or UUID or an
+// error listing the available networks to choose from
+func (i initMessage) FindNetwork(id string) (*network, error) {
+	if n := i.NetworkByNameOrUUID(id); n != nil {
+		return n, nil
+	}
+
+	var available []string
+	for _, n := range i.Networks {
+		available = append(available, fmt.Sprintf("%s (%s)", n.Name, n.UUID))
+	}
+	sort.Strings(available)
+
+	return nil, networkNotFoundError{ID: id, Available: available}
+}
+
 func (i initMessage) NetworkByNameOrUUID(id string) *network {
 	for _, n := range i.Networks {
 		if n.Name == id || n.UUID == id {
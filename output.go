@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	outputCSV      = "csv"
+	outputJSON     = "json"
+	outputJSONL    = "jsonl"
+	outputTable    = "table"
+	outputTemplate = "template"
+	outputText     = "text"
+	outputYAML     = "yaml"
+)
+
+type outputFormat struct {
+	name string
+	tmpl *template.Template
+}
+
+// actionResult is emitted by commands sending commands or messages
+// into TheLounge
+type actionResult struct {
+	Action  string `json:"action" yaml:"action"`
+	Network string `json:"network" yaml:"network"`
+	Target  string `json:"target" yaml:"target"`
+	Text    string `json:"text,omitempty" yaml:"text,omitempty"`
+	// Error contains why the server rejected the action
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func (a actionResult) String() string {
+	if a.Error != "" {
+		return fmt.Sprintf("%s %s failed: %s", a.Action, a.Target, a.Error)
+	}
+	return strings.TrimSpace(a.Action + " " + a.Target)
+}
+
+var output = &outputFormat{name: outputText}
+
+// parseOutputFormat parses the value of the --output flag: one of the
+// format names or "template=<Go template>" executed for every result
+func parseOutputFormat(spec string) (*outputFormat, error) {
+	if strings.HasPrefix(spec, outputTemplate+"=") {
+		tmpl, err := template.New("output").Parse(strings.TrimPrefix(spec, outputTemplate+"="))
+		if err != nil {
+			return nil, usageError{errors.Wrap(err, "Unable to parse output template")}
+		}
+		return &outputFormat{name: outputTemplate, tmpl: tmpl}, nil
+	}
+
+	switch spec {
+	case outputCSV, outputJSON, outputJSONL, outputTable, outputText, outputYAML:
+		return &outputFormat{name: spec}, nil
+	case outputTemplate:
+		return nil, usageErrorf("Template output requires a template: template=<template>")
+	default:
+		return nil, usageErrorf("Unknown output format %q", spec)
+	}
+}
+
+// printResults writes the results (a slice of structs) to stdout in
+// the selected format. For text output results implementing
+// fmt.Stringer are printed one per line, others are printed as table.
+func printResults(results interface{}) error {
+	rows := reflect.ValueOf(results)
+	if rows.Kind() != reflect.Slice {
+		return errors.New("Results must be passed as slice")
+	}
+
+	switch output.name {
+
+	case outputCSV:
+		return printCSV(rows)
+
+	case outputJSON:
+		if rows.IsNil() {
+			// Always print a list to not confuse consumers
+			results = []interface{}{}
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(results), "Unable to encode results")
+
+	case outputJSONL:
+		enc := json.NewEncoder(stdout)
+		for i := 0; i < rows.Len(); i++ {
+			if err := enc.Encode(rows.Index(i).Interface()); err != nil {
+				return errors.Wrap(err, "Unable to encode result")
+			}
+		}
+		return nil
+
+	case outputTable:
+		return printTable(rows)
+
+	case outputTemplate:
+		for i := 0; i < rows.Len(); i++ {
+			if err := output.tmpl.Execute(stdout, rows.Index(i).Interface()); err != nil {
+				return errors.Wrap(err, "Unable to execute output template")
+			}
+			fmt.Fprintln(stdout)
+		}
+		return nil
+
+	case outputYAML:
+		if rows.Len() == 0 {
+			_, err := fmt.Fprintln(stdout, "[]")
+			return err
+		}
+		raw, err := yaml.Marshal(results)
+		if err != nil {
+			return errors.Wrap(err, "Unable to encode results")
+		}
+		_, err = stdout.Write(raw)
+		return err
+
+	default:
+		if !rows.Type().Elem().Implements(reflect.TypeOf((*fmt.Stringer)(nil)).Elem()) {
+			return printTable(rows)
+		}
+
+		for i := 0; i < rows.Len(); i++ {
+			fmt.Fprintln(stdout, rows.Index(i).Interface())
+		}
+		return nil
+
+	}
+}
+
+// printCSV prints the results as CSV using the JSON names of the
+// fields as header
+func printCSV(rows reflect.Value) error {
+	fields, headers, err := resultFields(rows)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(stdout)
+	w.Write(headers)
+	for i := 0; i < rows.Len(); i++ {
+		w.Write(resultValues(rows.Index(i), fields))
+	}
+	w.Flush()
+
+	return errors.Wrap(w.Error(), "Unable to write CSV")
+}
+
+// printTable prints the results as table using the JSON names of the
+// fields as headers
+func printTable(rows reflect.Value) error {
+	fields, headers, err := resultFields(rows)
+	if err != nil {
+		return err
+	}
+
+	for i := range headers {
+		headers[i] = strings.ToUpper(headers[i])
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for i := 0; i < rows.Len(); i++ {
+		fmt.Fprintln(tw, strings.Join(resultValues(rows.Index(i), fields), "\t"))
+	}
+
+	return errors.Wrap(tw.Flush(), "Unable to write table")
+}
+
+// resultFields returns the indices and JSON names of the fields to
+// print for the results
+func resultFields(rows reflect.Value) ([]int, []string, error) {
+	var (
+		elemType = rows.Type().Elem()
+		fields   []int
+		names    []string
+	)
+
+	if elemType.Kind() != reflect.Struct {
+		return nil, nil, errors.New("Tabular output requires struct results")
+	}
+
+	for i := 0; i < elemType.NumField(); i++ {
+		name := strings.Split(elemType.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, i)
+		names = append(names, name)
+	}
+
+	return fields, names, nil
+}
+
+func resultValues(row reflect.Value, fields []int) []string {
+	var values []string
+	for _, f := range fields {
+		switch v := row.Field(f).Interface().(type) {
+		case time.Time:
+			values = append(values, v.Format(time.RFC3339))
+		default:
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+
+	return values
+}
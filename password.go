@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var (
+	stdin io.Reader = os.Stdin
+
+	// passwordCache holds the password once it was read from its source
+	// as stdin can only be read once and commands might be expensive
+	passwordCache *string
+)
+
+// validatePasswordSources ensures not more than one password source is
+// configured. If none is given the user is prompted when attached to a
+// terminal and no stored session is available.
+func validatePasswordSources() error {
+	var sources []string
+
+	if cfg.Password != "" {
+		sources = append(sources, "--password")
+	}
+	if cfg.PasswordCommand != "" {
+		sources = append(sources, "--password-command")
+	}
+	if cfg.PasswordFile != "" {
+		sources = append(sources, "--password-file")
+	}
+	if cfg.PasswordStdin {
+		sources = append(sources, "--password-stdin")
+	}
+
+	if len(sources) > 1 {
+		return usageErrorf("Only one password source may be given, got %s", strings.Join(sources, ", "))
+	}
+
+	return nil
+}
+
+// password returns the password read from the configured source
+func password() (string, error) {
+	if passwordCache != nil {
+		return *passwordCache, nil
+	}
+
+	var (
+		pass string
+		err  error
+	)
+
+	switch {
+	case cfg.Password != "":
+		pass = cfg.Password
+
+	case cfg.PasswordCommand != "":
+		pass, err = passwordFromCommand(cfg.PasswordCommand)
+
+	case cfg.PasswordFile != "":
+		pass, err = passwordFromFile(cfg.PasswordFile)
+
+	case cfg.PasswordStdin:
+		pass, err = firstLine(stdin)
+		err = errors.Wrap(err, "Unable to read password from stdin")
+
+	case stdin == os.Stdin && terminal.IsTerminal(int(os.Stdin.Fd())):
+		pass, err = passwordFromPrompt()
+
+	default:
+		return "", usageErrorf("No password given and no stored session available")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if pass == "" {
+		return "", errors.New("Password from source was empty")
+	}
+
+	passwordCache = &pass
+	return pass, nil
+}
+
+func passwordFromCommand(command string) (string, error) {
+	buf := new(bytes.Buffer)
+
+	cmd := shellCommand(context.Background(), command)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = buf
+
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, "Password command failed")
+	}
+
+	// Password managers like pass store additional data after the first
+	// line of their output
+	pass, err := firstLine(buf)
+	return pass, errors.Wrap(err, "Unable to read password command output")
+}
+
+func passwordFromFile(filename string) (string, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to read password file")
+	}
+
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
+
+func passwordFromPrompt() (string, error) {
+	fmt.Fprintf(os.Stderr, "Password for %s: ", cfg.Username)
+	pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+
+	return string(pass), errors.Wrap(err, "Unable to read password from terminal")
+}
+
+func firstLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// shellCommand executes the command through the shell of the system.
+// The shell is killed when the context is done.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	shell, flag := "/bin/sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	return exec.CommandContext(ctx, shell, flag, command)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lounge-control")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	passFile := filepath.Join(dir, "password")
+	if err = ioutil.WriteFile(passFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("Unable to write password file: %s", err)
+	}
+
+	defer func() {
+		cfg.Password, cfg.PasswordCommand, cfg.PasswordFile, cfg.PasswordStdin = "", "", "", false
+		stdin, passwordCache = os.Stdin, nil
+	}()
+
+	for _, tc := range []struct {
+		name     string
+		setup    func()
+		expected string
+	}{
+		{"flag", func() { cfg.Password = "from-flag" }, "from-flag"},
+		{"file", func() { cfg.PasswordFile = passFile }, "from-file"},
+		{"command", func() { cfg.PasswordCommand = "printf 'from-command\\nuser: luzifer\\n'" }, "from-command"},
+		{"stdin", func() { cfg.PasswordStdin, stdin = true, strings.NewReader("from-stdin\nignored") }, "from-stdin"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.Password, cfg.PasswordCommand, cfg.PasswordFile, cfg.PasswordStdin = "", "", "", false
+			passwordCache = nil
+			tc.setup()
+
+			if err := validatePasswordSources(); err != nil {
+				t.Fatalf("Validation failed: %s", err)
+			}
+
+			pass, err := password()
+			if err != nil {
+				t.Fatalf("Unable to read password: %s", err)
+			}
+			if pass != tc.expected {
+				t.Errorf("Expected password %q, got %q", tc.expected, pass)
+			}
+		})
+	}
+
+	cfg.Password, cfg.PasswordFile = "from-flag", passFile
+	if err = validatePasswordSources(); err == nil {
+		t.Error("Expected multiple sources to be rejected")
+	}
+
+	cfg.Password, cfg.PasswordFile, cfg.PasswordCommand = "", "", "exit 1"
+	passwordCache = nil
+	if _, err = password(); err == nil {
+		t.Error("Expected failing command to be reported")
+	}
+}
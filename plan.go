@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Operations of plan steps in the diff-style plan output
+const (
+	planAdd    = "+"
+	planChange = "~"
+	planRemove = "-"
+	planRetain = "="
+)
+
+// maskedKey replaces channel keys in the printed plan
+const maskedKey = "********"
+
+// planStep describes an input a command sends (or in case of planRetain
+// does not need to send) into TheLounge. In --dry-run mode commands
+// print their steps instead of executing them.
+type planStep struct {
+	Op      string `json:"op" yaml:"op"`
+	Action  string `json:"action" yaml:"action"`
+	Network string `json:"network" yaml:"network"`
+	Target  string `json:"target" yaml:"target"`
+	// Input is the text sent as input with the channel key masked,
+	// empty for retained channels
+	Input string `json:"input,omitempty" yaml:"input,omitempty"`
+	// key is the channel key to join with, unexported to keep it out of
+	// every output format
+	key string
+}
+
+// withKey returns the join step using the given channel key
+func (p planStep) withKey(key string) planStep {
+	p.Input = "/join " + p.Target + " " + maskedKey
+	p.key = key
+	return p
+}
+
+// text returns the text to send as input including the channel key
+func (p planStep) text() string {
+	if p.key == "" {
+		return p.Input
+	}
+	return "/join " + p.Target + " " + p.key
+}
+
+func (p planStep) String() string {
+	switch p.Action {
+	case "send":
+		return fmt.Sprintf("%s send %s: %s", p.Op, p.Target, p.Input)
+	case "topic":
+		return fmt.Sprintf("%s topic %s: %s", p.Op, p.Target, strings.TrimPrefix(p.Input, "/topic "))
+	}
+	return fmt.Sprintf("%s %s %s", p.Op, p.Action, p.Target)
+}
+
+func joinStep(network, channel string) planStep {
+	return planStep{Op: planAdd, Action: "join", Network: network, Target: channel, Input: "/join " + channel}
+}
+
+func topicStep(network, channel, topic string) planStep {
+	return planStep{Op: planChange, Action: "topic", Network: network, Target: channel, Input: "/topic " + topic}
+}
+
+func partStep(network, channel string) planStep {
+	return planStep{Op: planRemove, Action: "part", Network: network, Target: channel, Input: "/part " + channel}
+}
+
+// diffChannels plans the joins and parts to turn the present channels
+// into the expected ones, channels in both lists are retained. Channel
+// names are compared case insensitive as IRC does.
+func diffChannels(network string, present, expected []string) []planStep {
+	var (
+		isExpected = map[string]bool{}
+		isPresent  = map[string]bool{}
+		steps      []planStep
+	)
+
+	for _, c := range present {
+		isPresent[strings.ToLower(c)] = true
+	}
+
+	for _, c := range expected {
+		key := strings.ToLower(c)
+		if isExpected[key] {
+			// Channel is listed twice
+			continue
+		}
+		isExpected[key] = true
+
+		if !isPresent[key] {
+			steps = append(steps, joinStep(network, c))
+		}
+	}
+
+	for _, c := range present {
+		if isExpected[strings.ToLower(c)] {
+			steps = append(steps, planStep{Op: planRetain, Action: "retain", Network: network, Target: c})
+		} else {
+			steps = append(steps, partStep(network, c))
+		}
+	}
+
+	return steps
+}
+
+// countSteps returns the number of steps with the given operation
+func countSteps(steps []planStep, op string) int {
+	var n int
+	for _, s := range steps {
+		if s.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+// printPlan prints the steps instead of executing them and ends the
+// command
+func printPlan(steps []planStep) error {
+	if err := printResults(steps); err != nil {
+		return err
+	}
+
+	interrupt <- os.Interrupt
+	return nil
+}
+
+// channelName adds the "#" prefix to channel names given without it
+func channelName(name string) string {
+	if !strings.HasPrefix(name, "#") {
+		return "#" + name
+	}
+	return name
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffChannels(t *testing.T) {
+	steps := diffChannels("Twitch", []string{"#a", "#b", "#c"}, []string{"#c", "#d", "#a"})
+
+	expected := []planStep{
+		{Op: planAdd, Action: "join", Network: "Twitch", Target: "#d", Input: "/join #d"},
+		{Op: planRetain, Action: "retain", Network: "Twitch", Target: "#a"},
+		{Op: planRemove, Action: "part", Network: "Twitch", Target: "#b", Input: "/part #b"},
+		{Op: planRetain, Action: "retain", Network: "Twitch", Target: "#c"},
+	}
+
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Unexpected plan: %+v", steps)
+	}
+}
+
+func TestDiffChannelsCase(t *testing.T) {
+	steps := diffChannels("Libera", []string{"#go-nuts"}, []string{"#Go-Nuts", "#new", "#NEW"})
+
+	expected := []planStep{
+		{Op: planAdd, Action: "join", Network: "Libera", Target: "#new", Input: "/join #new"},
+		{Op: planRetain, Action: "retain", Network: "Libera", Target: "#go-nuts"},
+	}
+
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Unexpected plan: %+v", steps)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	defer func() { cfg.DryRun = false }()
+	cfg.DryRun = true
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"join", "baz", "#foo"}, "+ join #baz\n= retain #foo\n"},
+		{[]string{"part", "foo", "unknown"}, "- part #foo\n"},
+		{[]string{"send", "#bar", "Hello World"}, "+ send #bar: Hello World\n"},
+	} {
+		out, err := runCommand(t, srv, "Libera", tc.args...)
+		if err != nil {
+			t.Fatalf("Command %v failed: %s", tc.args, err)
+		}
+
+		if out != tc.expected {
+			t.Errorf("Unexpected plan for %v: %q", tc.args, out)
+		}
+	}
+
+	if inputs := srv.Inputs(); len(inputs) != 0 {
+		t.Errorf("Expected no inputs to be sent, got %+v", inputs)
+	}
+}
+
+func TestDryRunSyncTwitchFollows(t *testing.T) {
+	api := newFakeTwitch(t)
+	defer api.Close()
+
+	defer func() { cfg.DryRun, cfg.Output = false, "" }()
+	cfg.DryRun = true
+	cfg.Output = outputJSON
+
+	srv := newTestLounge(t)
+	defer srv.Close()
+
+	out, err := runCommand(t, srv, "Twitch", "sync-twitch-follows")
+	if err != nil {
+		t.Fatalf("Command failed: %s", err)
+	}
+
+	var steps []planStep
+	if err = json.Unmarshal([]byte(out), &steps); err != nil {
+		t.Fatalf("Unable to decode plan %q: %s", out, err)
+	}
+
+	expected := []planStep{
+		{Op: planAdd, Action: "join", Network: "Twitch", Target: "#newstream", Input: "/join #newstream"},
+		{Op: planRetain, Action: "retain", Network: "Twitch", Target: "#luzifer"},
+		{Op: planRemove, Action: "part", Network: "Twitch", Target: "#oldstream", Input: "/part #oldstream"},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Unexpected plan: %+v", steps)
+	}
+
+	if inputs := srv.Inputs(); len(inputs) != 0 {
+		t.Errorf("Expected no inputs to be sent, got %+v", inputs)
+	}
+}
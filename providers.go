@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerProvider("command", newCommandProvider)
+	registerProvider("file", newFileProvider)
+	registerProvider("http", newHTTPProvider)
+}
+
+// commandProvider reads the channel list from the output of a shell
+// command having the network passed in LOUNGE_NETWORK and
+// LOUNGE_NETWORK_UUID
+type commandProvider struct{ command string }
+
+func newCommandProvider(arg string) (channelProvider, error) {
+	if arg == "" {
+		return nil, usageErrorf("Usage: sync command <command>")
+	}
+	return commandProvider{command: arg}, nil
+}
+
+func (c commandProvider) Channels(network *network) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), cfg.Timeout)
+	}
+	defer cancel()
+
+	buf := new(bytes.Buffer)
+
+	cmd := shellCommand(ctx, c.command)
+	cmd.Env = append(os.Environ(), "LOUNGE_NETWORK="+network.Name, "LOUNGE_NETWORK_UUID="+network.UUID)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = buf
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "Channel list command failed")
+	}
+
+	// Children of the killed shell might keep its output open which
+	// would block waiting for the command
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.New("Channel list command timed out")
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Channel list command failed")
+		}
+	case <-ctx.Done():
+		return nil, errors.New("Channel list command timed out")
+	}
+
+	return parseChannelList(buf.Bytes(), network)
+}
+
+// fileProvider reads the channel list from a local file
+type fileProvider struct{ filename string }
+
+func newFileProvider(arg string) (channelProvider, error) {
+	if arg == "" {
+		return nil, usageErrorf("Usage: sync file <file>")
+	}
+	return fileProvider{filename: arg}, nil
+}
+
+func (f fileProvider) Channels(network *network) ([]string, error) {
+	raw, err := ioutil.ReadFile(f.filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read channel list")
+	}
+
+	return parseChannelList(raw, network)
+}
+
+// httpProvider fetches the channel list from an URL
+type httpProvider struct{ url string }
+
+func newHTTPProvider(arg string) (channelProvider, error) {
+	if !strings.HasPrefix(arg, "http://") && !strings.HasPrefix(arg, "https://") {
+		return nil, usageErrorf("Usage: sync http <http(s) URL>")
+	}
+	return httpProvider{url: arg}, nil
+}
+
+func (h httpProvider) Channels(network *network) ([]string, error) {
+	resp, err := httpClient().Get(h.url)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to fetch channel list")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Unexpected status fetching channel list: %s", resp.Status)
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read channel list")
+	}
+
+	return parseChannelList(raw, network)
+}
+
+// httpClient returns the client for requests of providers which are
+// bounded by --timeout as they are executed while the connection is not
+// read
+func httpClient() *http.Client {
+	return &http.Client{Timeout: cfg.Timeout}
+}
+
+// parseChannelList parses the channel list returned by providers which
+// is either a JSON list of channels, a JSON object mapping network
+// names or UUIDs to lists of channels or one channel per line
+func parseChannelList(raw []byte, network *network) ([]string, error) {
+	raw = bytes.TrimSpace(raw)
+
+	switch {
+
+	case bytes.HasPrefix(raw, []byte("[")):
+		var channels []string
+		err := json.Unmarshal(raw, &channels)
+		return channels, errors.Wrap(err, "Unable to parse channel list")
+
+	case bytes.HasPrefix(raw, []byte("{")):
+		var networks map[string][]string
+		if err := json.Unmarshal(raw, &networks); err != nil {
+			return nil, errors.Wrap(err, "Unable to parse channel list")
+		}
+
+		for _, id := range []string{network.Name, network.UUID} {
+			if channels, ok := networks[id]; ok {
+				return channels, nil
+			}
+		}
+		return nil, errors.Errorf("Channel list does not contain network %q", network.Name)
+
+	}
+
+	var (
+		channels []string
+		scanner  = bufio.NewScanner(bytes.NewReader(raw))
+	)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			channels = append(channels, line)
+		}
+	}
+
+	return channels, errors.Wrap(scanner.Err(), "Unable to read channel list")
+}
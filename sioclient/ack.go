@@ -0,0 +1,124 @@
+package sioclient
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type ackRegistry struct {
+	lastID  int
+	pending map[int]chan []json.RawMessage
+	lock    sync.Mutex
+}
+
+// Emit sends an event with the given arguments to the default
+// namespace without requesting an acknowledgement from the server
+func (c *Client) Emit(event string, args ...interface{}) error {
+	return c.Of(defaultNamespace).Emit(event, args...)
+}
+
+// EmitWithAck sends an event to the default namespace, see
+// Namespace.EmitWithAck
+func (c *Client) EmitWithAck(ctx context.Context, event string, args ...interface{}) ([]json.RawMessage, error) {
+	return c.Of(defaultNamespace).EmitWithAck(ctx, event, args...)
+}
+
+// Emit sends an event with the given arguments without requesting an
+// acknowledgement from the server
+func (n *Namespace) Emit(event string, args ...interface{}) error {
+	msg, err := newEventMessage(n.name, 0, event, args...)
+	if err != nil {
+		return err
+	}
+
+	return msg.Send(n.client)
+}
+
+// EmitWithAck sends an event requesting an acknowledgement and blocks
+// until the server acknowledged it or the context is done. The
+// arguments passed by the server into the acknowledgement are returned.
+func (n *Namespace) EmitWithAck(ctx context.Context, event string, args ...interface{}) ([]json.RawMessage, error) {
+	id, ackC := n.acks.register()
+	defer n.acks.unregister(id)
+
+	msg, err := newEventMessage(n.name, id, event, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = msg.Send(n.client); err != nil {
+		return nil, errors.Wrap(err, "Unable to send event")
+	}
+
+	select {
+	case payload := <-ackC:
+		return payload, nil
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "Waiting for acknowledgement")
+	}
+}
+
+func (a *ackRegistry) register() (int, <-chan []json.RawMessage) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.pending == nil {
+		a.pending = map[int]chan []json.RawMessage{}
+	}
+
+	// IDs start at 1 as ID 0 is not encoded into messages
+	a.lastID++
+	c := make(chan []json.RawMessage, 1)
+	a.pending[a.lastID] = c
+
+	return a.lastID, c
+}
+
+// resolve delivers the acknowledgement to the waiting emitter and
+// reports whether one was waiting for it
+func (a *ackRegistry) resolve(m *Message) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	c, ok := a.pending[m.ID]
+	if !ok {
+		return false
+	}
+
+	c <- m.Payload
+	delete(a.pending, m.ID)
+	return true
+}
+
+func (a *ackRegistry) unregister(id int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	delete(a.pending, id)
+}
+
+func newEventMessage(namespace string, id int, event string, args ...interface{}) (*Message, error) {
+	out := &Message{
+		Type:      MessageTypeEvent,
+		Namespace: namespace,
+		ID:        id,
+		Payload:   make([]json.RawMessage, len(args)+1),
+	}
+
+	var err error
+
+	if out.Payload[0], err = json.Marshal(event); err != nil {
+		return nil, errors.Wrap(err, "Unable to marshal event name")
+	}
+
+	for i, arg := range args {
+		if out.Payload[i+1], err = json.Marshal(arg); err != nil {
+			return nil, errors.Wrapf(err, "Unable to marshal argument %d", i)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,51 @@
+package sioclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEmitWithAck(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	client, err := New(Config{
+		MessageHandler: func(*Message) error { return nil },
+		URL:            srv.URL(),
+	})
+	if err != nil {
+		t.Fatalf("Unable to create client: %s", err)
+	}
+	defer client.Close()
+
+	// Wait for the session to be established
+	srv.expectFrame(t, "2")
+
+	// Use enough messages to get multi-digit IDs
+	for i := 1; i <= 12; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		args, err := client.EmitWithAck(ctx, "echo", i, "arg")
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Unable to emit message %d: %s", i, err)
+		}
+
+		if len(args) != 2 || string(args[0]) != strconv.Itoa(i) || string(args[1]) != `"arg"` {
+			t.Errorf("Unexpected acknowledgement for message %d: %s", i, args)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err = client.EmitWithAck(ctx, "ignored"); err == nil {
+		t.Error("Expected timeout for unacknowledged event")
+	}
+
+	if l := len(client.Of("/").acks.pending); l != 0 {
+		t.Errorf("Expected no pending acknowledgements, got %d", l)
+	}
+}
@@ -0,0 +1,129 @@
+package sioclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// setupDialers creates the HTTP client used for polling and the
+// websocket dialer sharing proxy, TLS and cookie settings
+func (e *EIOClient) setupDialers() error {
+	proxy := http.ProxyFromEnvironment
+
+	if e.cfg.Proxy != nil {
+		switch e.cfg.Proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return errors.Errorf("Unsupported proxy scheme %q", e.cfg.Proxy.Scheme)
+		}
+
+		proxy = http.ProxyURL(e.cfg.Proxy)
+	}
+
+	e.httpClient = &http.Client{
+		Jar: e.cfg.Jar,
+		Transport: &http.Transport{
+			Proxy:               proxy,
+			TLSClientConfig:     e.cfg.TLSConfig,
+			TLSHandshakeTimeout: e.cfg.HandshakeTimeout,
+		},
+	}
+
+	e.dialer = &websocket.Dialer{
+		HandshakeTimeout: e.cfg.HandshakeTimeout,
+		Jar:              e.cfg.Jar,
+		Proxy:            proxy,
+		TLSClientConfig:  e.cfg.TLSConfig,
+	}
+
+	if e.cfg.Proxy != nil && e.cfg.Proxy.Scheme == "https" {
+		// The websocket library only knows how to talk to plain HTTP and
+		// SOCKS5 proxies so we need to tunnel through TLS proxies ourselves
+		e.dialer.Proxy = nil
+		e.dialer.NetDialContext = e.dialHTTPSProxy
+	}
+
+	return nil
+}
+
+// dialHTTPSProxy opens a TLS connection to the proxy and issues a
+// CONNECT request to the given address through it
+func (e *EIOClient) dialHTTPSProxy(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyAddr := e.cfg.Proxy.Host
+	if e.cfg.Proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(e.cfg.Proxy.Hostname(), "443")
+	}
+
+	raw, err := new(net.Dialer).DialContext(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to dial proxy")
+	}
+
+	// The websocket library sets its deadline only after the tunnel is
+	// established so the handshake timeout has to be applied here
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = raw.SetDeadline(deadline); err != nil {
+			raw.Close()
+			return nil, errors.Wrap(err, "Unable to set deadline")
+		}
+	}
+
+	tlsConfig := new(tls.Config)
+	if e.cfg.TLSConfig != nil {
+		tlsConfig = e.cfg.TLSConfig.Clone()
+	}
+	tlsConfig.ServerName = e.cfg.Proxy.Hostname()
+
+	conn := tls.Client(raw, tlsConfig)
+	if err = conn.Handshake(); err != nil {
+		raw.Close()
+		return nil, errors.Wrap(err, "Unable to execute TLS handshake with proxy")
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+
+	if u := e.cfg.Proxy.User; u != nil {
+		pass, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+pass)))
+	}
+
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "Unable to send CONNECT request")
+	}
+
+	// The proxy does not send data before we did after the tunnel is
+	// established so the buffered reader can not swallow any of it
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "Unable to read CONNECT response")
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.Errorf("Proxy refused CONNECT: %s", resp.Status)
+	}
+
+	if err = raw.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "Unable to clear deadline")
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,111 @@
+package sioclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDialerOptions(t *testing.T) {
+	for _, transport := range []string{TransportWebsocket, TransportPolling} {
+		t.Run(transport, func(t *testing.T) {
+			srv := newTLSTestServer(t)
+			srv.requestCheck = func(r *http.Request) bool {
+				c, err := r.Cookie("session")
+				return r.Header.Get("X-Auth") == "secret" && err == nil && c.Value == "abc"
+			}
+			defer srv.Close()
+
+			serverURL, _ := url.Parse(srv.Server.URL)
+			jar, _ := cookiejar.New(nil)
+			jar.SetCookies(serverURL, []*http.Cookie{{Name: "session", Value: "abc"}})
+
+			roots := x509.NewCertPool()
+			roots.AddCert(srv.Certificate())
+
+			cfg := Config{
+				Header:         http.Header{"X-Auth": []string{"secret"}},
+				Jar:            jar,
+				MessageHandler: func(*Message) error { return nil },
+				TLSConfig:      &tls.Config{RootCAs: roots},
+				Transport:      transport,
+				URL:            srv.URL(),
+			}
+
+			client, err := New(cfg)
+			if err != nil {
+				t.Fatalf("Unable to connect with dialer options: %s", err)
+			}
+			client.Close()
+
+			cfg.Header = nil
+			if client, err = New(cfg); err == nil {
+				client.Close()
+				t.Error("Expected server to reject client without header")
+			}
+
+			cfg.Header, cfg.TLSConfig = http.Header{"X-Auth": []string{"secret"}}, nil
+			if client, err = New(cfg); err == nil {
+				client.Close()
+				t.Error("Expected client to reject unknown certificate authority")
+			}
+		})
+	}
+}
+
+func TestUnsupportedProxy(t *testing.T) {
+	if _, err := NewClient(Config{
+		Proxy: &url.URL{Scheme: "ftp", Host: "localhost"},
+		URL:   "ws://localhost/socket.io/",
+	}); err == nil {
+		t.Error("Expected unsupported proxy scheme to be rejected")
+	}
+}
+
+func TestStalledHTTPSProxy(t *testing.T) {
+	// Proxy accepting connections without ever answering
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	errC := make(chan error, 1)
+	go func() {
+		client, err := New(Config{
+			HandshakeTimeout: 100 * time.Millisecond,
+			MessageHandler:   func(*Message) error { return nil },
+			Proxy:            &url.URL{Scheme: "https", Host: l.Addr().String()},
+			Transport:        TransportWebsocket,
+			URL:              "ws://localhost/socket.io/",
+		})
+		if err == nil {
+			client.Close()
+		}
+		errC <- err
+	}()
+
+	select {
+	case err := <-errC:
+		if err == nil {
+			t.Error("Expected stalled proxy to fail the connection")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Handshake timeout did not cover the proxy handshake")
+	}
+}
@@ -1,9 +1,13 @@
 package sioclient
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"strconv"
 	"sync"
@@ -25,12 +29,124 @@ const (
 	EIOMessageTypeNoop
 )
 
-var ErrNotConnected = errors.New("Websocket is not connected")
+type ConnectionState int
+
+const (
+	ConnectionStateDisconnected ConnectionState = iota
+	ConnectionStateConnected
+	ConnectionStateReconnecting
+	ConnectionStateGaveUp
+)
+
+func (c ConnectionState) String() string {
+	switch c {
+	case ConnectionStateDisconnected:
+		return "disconnected"
+	case ConnectionStateConnected:
+		return "connected"
+	case ConnectionStateReconnecting:
+		return "reconnecting"
+	case ConnectionStateGaveUp:
+		return "gave up"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(c))
+	}
+}
+
+const (
+	EIOVersion3 = 3
+	EIOVersion4 = 4
+)
+
+const (
+	TransportPolling   = "polling"
+	TransportWebsocket = "websocket"
+)
+
+const (
+	defaultReconnectBackoffMin = 500 * time.Millisecond
+	defaultReconnectBackoffMax = 30 * time.Second
+
+	upgradeProbeTimeout = 10 * time.Second
+)
+
+var (
+	ErrNotConnected    = errors.New("Websocket is not connected")
+	ErrReconnectFailed = errors.New("Unable to reconnect to server")
+)
+
+// PingTimeoutError is reported through Errors when the server did not
+// send anything within the ping interval and timeout negotiated in the
+// handshake. The connection is considered dead and closed, reconnects
+// are handled as for any other lost connection.
+type PingTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (p PingTimeoutError) Error() string {
+	return fmt.Sprintf("No heartbeat received from server within %s", p.Timeout)
+}
+
+// ConnectionLostError is reported through Errors when the connection
+// was lost and reconnecting is disabled
+type ConnectionLostError struct {
+	Err error
+}
+
+func (c ConnectionLostError) Error() string { return fmt.Sprintf("Connection lost: %s", c.Err) }
+
+func (c ConnectionLostError) Unwrap() error { return c.Err }
 
 type EIOClientConfig struct {
+	// HandshakeTimeout limits the time to open a session, 0 disables it
+	HandshakeTimeout time.Duration
+	// Header is added to all requests sent to the server
+	Header http.Header
+	// Jar stores the cookies of the server, defaults to an empty
+	// in-memory jar
+	Jar                  http.CookieJar
 	MessageHandlerBinary func([]byte) error
 	MessageHandlerText   func([]byte) error
-	URL                  string
+	// OpenHandler is called after every successful handshake, including
+	// those on reconnected sessions
+	OpenHandler func() error
+	// Proxy to connect through (http, https or socks5 scheme), if not set
+	// the proxy is taken from the environment (HTTP_PROXY, HTTPS_PROXY)
+	Proxy     *url.URL
+	Reconnect ReconnectConfig
+	// StateHandler is called synchronously on every transition of the
+	// connection state and therefore must not block
+	StateHandler func(ConnectionState)
+	// TLSConfig is used for connections to the server (custom CAs,
+	// client certificates, ...)
+	TLSConfig *tls.Config
+	// Transport to open the connection with (TransportWebsocket or
+	// TransportPolling), defaults to TransportWebsocket
+	Transport string
+	// Upgrade enables upgrading a polling connection to a websocket
+	// when the server offers it. If the websocket probe fails the
+	// connection stays on polling.
+	Upgrade bool
+	URL     string
+	// Version is the Engine.IO protocol version to speak (EIOVersion3
+	// or EIOVersion4), defaults to EIOVersion3
+	Version int
+}
+
+type ReconnectConfig struct {
+	// Attempts is the number of redials after a lost connection before
+	// giving up: 0 disables reconnects, a negative value retries forever
+	Attempts int
+	// BackoffMin and BackoffMax limit the exponential delay between two
+	// attempts (defaults: 500ms, 30s)
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+}
+
+type eioPacket struct {
+	Type   EIOMessageType
+	Data   []byte
+	Binary bool
 }
 
 type eioSessionStart struct {
@@ -40,155 +156,630 @@ type eioSessionStart struct {
 	PingInterval int64    `json:"pingInterval"`
 }
 
+// transport abstracts the way packets are exchanged with the server.
+// Read is only called from the read loop, Write may be called
+// concurrently.
+type transport interface {
+	Close() error
+	Name() string
+	Read() (eioPacket, error)
+	Write(eioPacket) error
+}
+
 type EIOClient struct {
-	cfg         EIOClientConfig
-	dialer      *websocket.Dialer
-	errC        chan error
-	isConnected bool
-	writeMutex  *sync.Mutex
-	ws          *websocket.Conn
+	cfg        EIOClientConfig
+	dialer     *websocket.Dialer
+	errC       chan error
+	httpClient *http.Client
+	socketURL  *url.URL
+
+	// ctx bounds the lifetime of the connection, cancel closes it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// done is closed when the read loop and pinger stopped
+	done     chan struct{}
+	doneOnce sync.Once
+	pingerWG sync.WaitGroup
+
+	connLock   sync.RWMutex
+	closed     bool
+	deadCause  error
+	pingerStop chan struct{}
+	state      ConnectionState
+	transport  transport
+
+	// heartbeat detects half-open connections, heartbeatSeq invalidates
+	// timers which fired while being stopped or reset
+	heartbeat        *time.Timer
+	heartbeatSeq     uint64
+	heartbeatTimeout time.Duration
 }
 
 func NewEIOClient(config EIOClientConfig) (*EIOClient, error) {
-	var (
-		client = new(EIOClient)
-		err    error
-	)
+	client, err := newEIOClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, client.connect(context.Background())
+}
+
+// newEIOClient prepares the client without dialing the server so the
+// caller is able to store the reference before the first message is
+// handled
+func newEIOClient(config EIOClientConfig) (*EIOClient, error) {
+	var client = new(EIOClient)
 
 	socketURL, err := url.Parse(config.URL)
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to parse URL")
 	}
 
+	switch config.Version {
+	case 0:
+		config.Version = EIOVersion3
+	case EIOVersion3, EIOVersion4:
+	default:
+		return nil, errors.Errorf("Unsupported EIO version %d", config.Version)
+	}
+
+	switch config.Transport {
+	case "":
+		config.Transport = TransportWebsocket
+	case TransportPolling, TransportWebsocket:
+	default:
+		return nil, errors.Errorf("Unsupported transport %q", config.Transport)
+	}
+
 	qVars := socketURL.Query()
-	qVars.Set("EIO", "3")
-	qVars.Set("transport", "websocket")
+	qVars.Set("EIO", strconv.Itoa(config.Version))
 
 	socketURL.RawQuery = qVars.Encode()
 
+	if config.Jar == nil {
+		// Load-balancers in front of Engine.IO servers tend to use cookies
+		// to stick polling requests to the same backend
+		if config.Jar, err = cookiejar.New(nil); err != nil {
+			return nil, errors.Wrap(err, "Unable to create cookie jar")
+		}
+	}
+
 	client.cfg = config
+	client.done = make(chan struct{})
 	client.errC = make(chan error, 10)
-	client.writeMutex = new(sync.Mutex)
-	client.ws, _, err = client.dialer.Dial(socketURL.String(), http.Header{})
-	if err != nil {
-		return nil, errors.Wrap(err, "Unable to dial to given URL")
+	client.socketURL = socketURL
+
+	if err = client.setupDialers(); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Close sends a close packet to the server and shuts down the
+// connection. Use Done to wait for all goroutines to stop.
+func (e *EIOClient) Close() error {
+	e.connLock.Lock()
+	if e.closed {
+		e.connLock.Unlock()
+		return nil
+	}
+	e.closed = true
+	e.stopHeartbeat()
+	e.stopPinger()
+	t, state, cancel := e.transport, e.state, e.cancel
+	e.connLock.Unlock()
+
+	if t != nil && state == ConnectionStateConnected {
+		// Let the server clean up the session instead of waiting for it to
+		// time out, failing to do so is nothing we could handle
+		t.Write(eioPacket{Type: EIOMessageTypeClose})
 	}
 
-	// Mark connection as established
-	client.isConnected = true
+	if cancel != nil {
+		cancel()
+	}
 
-	defaultCloseHandler := client.ws.CloseHandler()
-	client.ws.SetCloseHandler(func(code int, text string) error {
-		client.isConnected = false
-		return defaultCloseHandler(code, text)
-	})
+	e.setState(ConnectionStateDisconnected)
 
-	go func() {
-		for client.isConnected {
-			messageType, message, err := client.ws.ReadMessage()
-			if err != nil {
-				client.errC <- err
-				continue
-			}
+	if t == nil {
+		// Client was never connected, there is no read loop to stop
+		e.closeDone()
+		return nil
+	}
+	return t.Close()
+}
 
-			if err = client.handleMessage(messageType, message); err != nil {
-				client.errC <- err
-				continue
-			}
-		}
-	}()
+// Done returns a channel closed after the client was closed (or gave up
+// reconnecting) and its goroutines have stopped
+func (e *EIOClient) Done() <-chan struct{} { return e.done }
 
-	return client, nil
+func (e *EIOClient) Errors() <-chan error { return e.errC }
+
+func (e *EIOClient) SendBinaryMessage(data []byte) error {
+	return e.send(eioPacket{Type: EIOMessageTypeMessage, Data: data, Binary: true})
 }
 
-func (e EIOClient) Close() error { return e.ws.Close() }
+func (e *EIOClient) SendTextMessage(t EIOMessageType, data string) error {
+	return e.send(eioPacket{Type: t, Data: []byte(data)})
+}
 
-func (e EIOClient) Errors() <-chan error { return e.errC }
+func (e *EIOClient) State() ConnectionState {
+	e.connLock.RLock()
+	defer e.connLock.RUnlock()
 
-func (e EIOClient) SendTextMessage(t EIOMessageType, data string) error {
-	if !e.isConnected {
-		return ErrNotConnected
-	}
+	return e.state
+}
 
-	e.writeMutex.Lock()
-	defer e.writeMutex.Unlock()
+// Transport returns the name of the transport currently in use
+func (e *EIOClient) Transport() string {
+	e.connLock.RLock()
+	defer e.connLock.RUnlock()
 
-	return errors.Wrap(
-		e.ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d%s", t, data))),
-		"Unable to transmit message",
+	if e.transport == nil {
+		return ""
+	}
+	return e.transport.Name()
+}
+
+func (e *EIOClient) backoff(attempt int) time.Duration {
+	var (
+		min = e.cfg.Reconnect.BackoffMin
+		max = e.cfg.Reconnect.BackoffMax
 	)
+
+	if min <= 0 {
+		min = defaultReconnectBackoffMin
+	}
+	if max < min {
+		max = defaultReconnectBackoffMax
+	}
+
+	delay := min
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// Use "equal jitter" to not have all clients hammer the server at the
+	// same time after an outage: wait at least half of the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (e *EIOClient) closeDone() {
+	e.pingerWG.Wait()
+	e.doneOnce.Do(func() { close(e.done) })
 }
 
-func (e EIOClient) handleMessage(messageType int, message []byte) error {
-	if len(message) < 1 {
-		return errors.New("Empty message received")
+// connect dials the server and starts the read loop. The context bounds
+// the dial and the lifetime of the connection: when it is cancelled
+// the client is closed.
+func (e *EIOClient) connect(ctx context.Context) error {
+	e.connLock.Lock()
+	if e.closed || e.ctx != nil {
+		e.connLock.Unlock()
+		return errors.New("Client was already connected or closed")
 	}
+	e.ctx, e.cancel = context.WithCancel(ctx)
+	e.connLock.Unlock()
 
-	var mType EIOMessageType
+	t, err := e.open(e.ctx)
+	if err != nil {
+		e.cancel()
+		e.closeDone()
+		return errors.Wrap(err, "Unable to dial to given URL")
+	}
 
-	switch messageType {
+	if !e.setConnection(t) {
+		t.Close()
+		e.closeDone()
+		return errors.New("Client was closed while dialing")
+	}
 
-	case websocket.TextMessage:
-		v, err := strconv.Atoi(string(message[0]))
-		if err != nil {
-			return errors.Wrap(err, "Unable to parse message type")
+	var (
+		stopped = make(chan struct{})
+		watched = make(chan struct{})
+	)
+
+	go func() {
+		defer close(watched)
+
+		select {
+		case <-e.ctx.Done():
+			e.Close()
+		case <-stopped:
 		}
-		mType = EIOMessageType(v)
+	}()
 
-	case websocket.BinaryMessage:
-		mType = EIOMessageType(message[0])
+	go func() {
+		e.readLoop()
+
+		// Stop the watcher before cancelling the context, the client which
+		// gave up must not be closed by it
+		close(stopped)
+		<-watched
+		e.cancel()
+		e.closeDone()
+	}()
 
-	}
+	return nil
+}
 
-	switch mType {
+func (e *EIOClient) handlePacket(p eioPacket) error {
+	// Every packet proves the connection to be alive, not only pings
+	// (v4) and pongs (v3)
+	e.resetHeartbeat()
+
+	switch p.Type {
 
 	case EIOMessageTypeOpen:
 		var handshake eioSessionStart
 
-		if err := json.Unmarshal(message[1:], &handshake); err != nil {
+		if err := json.Unmarshal(p.Data, &handshake); err != nil {
 			return errors.Wrap(err, "Unable to unmarshal handshake")
 		}
 
-		// Start pinger
-		go func() {
-			for t := time.NewTicker(time.Duration(handshake.PingInterval) * time.Millisecond); e.isConnected; <-t.C {
-				e.SendTextMessage(EIOMessageTypePing, "")
+		// The server pings (v4) or expects pings (v3) every interval and
+		// closes the session if the other side does not answer within
+		// the timeout, so we wait the same time before giving up on it
+		e.connLock.Lock()
+		e.heartbeatTimeout = time.Duration(handshake.PingInterval+handshake.PingTimeout) * time.Millisecond
+		e.connLock.Unlock()
+		e.resetHeartbeat()
+
+		if e.cfg.Version == EIOVersion3 {
+			// In EIO v3 the client is responsible to ping the server, starting
+			// with v4 the server pings and we only answer with pongs
+			e.startPinger(time.Duration(handshake.PingInterval) * time.Millisecond)
+		}
+
+		if e.cfg.OpenHandler != nil {
+			if err := e.cfg.OpenHandler(); err != nil {
+				return errors.Wrap(err, "Failed to handle open")
 			}
-		}()
+		}
+
+		e.maybeUpgrade(handshake)
 
 	case EIOMessageTypeClose:
-		e.ws.Close()
+		e.connLock.RLock()
+		e.transport.Close()
+		e.connLock.RUnlock()
 
 	case EIOMessageTypePing:
-		e.SendTextMessage(EIOMessageTypePong, "")
+		e.SendTextMessage(EIOMessageTypePong, string(p.Data))
 
 	case EIOMessageTypePong:
 		// Ignore
 
 	case EIOMessageTypeMessage:
-		var hdl func([]byte) error
-
-		switch messageType {
-		case websocket.TextMessage:
-			hdl = e.cfg.MessageHandlerText
-		case websocket.BinaryMessage:
+		hdl := e.cfg.MessageHandlerText
+		if p.Binary {
 			hdl = e.cfg.MessageHandlerBinary
 		}
 
-		if err := hdl(message[1:]); err != nil {
+		if hdl == nil {
+			return errors.New("No handler for message type registered")
+		}
+
+		if err := hdl(p.Data); err != nil {
 			return errors.Wrap(err, "Failed to handle message")
 		}
 
 	case EIOMessageTypeUpgrade:
-		// Ignore?
+		// Only sent by clients
 
 	case EIOMessageTypeNoop:
 		// Noop!
 
 	default:
-		return errors.Errorf("Received unknown EIO message type %d", mType)
+		return errors.Errorf("Received unknown EIO message type %d", p.Type)
 
 	}
 
 	return nil
 }
+
+func (e *EIOClient) isClosed() bool {
+	e.connLock.RLock()
+	defer e.connLock.RUnlock()
+
+	return e.closed
+}
+
+// maybeUpgrade tries to switch a polling connection to a websocket if
+// enabled and offered by the server. On failure the connection keeps
+// using the polling transport.
+func (e *EIOClient) maybeUpgrade(handshake eioSessionStart) {
+	e.connLock.RLock()
+	poll, ok := e.transport.(*pollingTransport)
+	e.connLock.RUnlock()
+
+	if !ok || !e.cfg.Upgrade {
+		return
+	}
+
+	var offered bool
+	for _, u := range handshake.Upgrades {
+		offered = offered || u == TransportWebsocket
+	}
+	if !offered {
+		return
+	}
+
+	ws, err := e.dialWebsocket(e.ctx, handshake.SID)
+	if err != nil {
+		return
+	}
+
+	if err = ws.probe(); err != nil {
+		ws.Close()
+		return
+	}
+
+	// The read loop is blocked in this handler so the polling transport
+	// has no request in flight. Packets already fetched by it are handed
+	// over to not lose them.
+	ws.pending = poll.drain()
+
+	e.connLock.Lock()
+	e.transport = ws
+	e.connLock.Unlock()
+
+	poll.Close()
+}
+
+// open establishes a new Engine.IO session using the configured
+// transport. The open packet is not consumed and will be handled by the
+// read loop.
+func (e *EIOClient) open(ctx context.Context) (transport, error) {
+	if e.cfg.Transport == TransportPolling {
+		return e.openPolling(ctx)
+	}
+
+	return e.dialWebsocket(ctx, "")
+}
+
+func (e *EIOClient) readLoop() {
+	for {
+		e.connLock.RLock()
+		t := e.transport
+		e.connLock.RUnlock()
+
+		p, err := t.Read()
+		if err != nil {
+			if e.isClosed() {
+				return
+			}
+
+			e.connLock.Lock()
+			if e.deadCause != nil {
+				// The transport was closed by us, report why
+				err, e.deadCause = e.deadCause, nil
+			}
+			e.connLock.Unlock()
+
+			if !e.reconnect(err) {
+				return
+			}
+
+			continue
+		}
+
+		if err = e.handlePacket(p); err != nil {
+			e.errC <- err
+			continue
+		}
+	}
+}
+
+// reconnect redials the server after the connection was lost and
+// reports whether a new connection has been established. The server
+// will send a fresh handshake on the new connection which restarts the
+// pinger and makes the Socket.IO layer see a new session.
+func (e *EIOClient) reconnect(cause error) bool {
+	e.connLock.Lock()
+	e.stopHeartbeat()
+	e.stopPinger()
+	e.transport.Close()
+	e.connLock.Unlock()
+
+	if e.cfg.Reconnect.Attempts == 0 {
+		e.setState(ConnectionStateGaveUp)
+		e.errC <- ConnectionLostError{Err: cause}
+		return false
+	}
+
+	e.setState(ConnectionStateReconnecting)
+
+	for attempt := 1; e.cfg.Reconnect.Attempts < 0 || attempt <= e.cfg.Reconnect.Attempts; attempt++ {
+		select {
+		case <-time.After(e.backoff(attempt)):
+		case <-e.ctx.Done():
+			return false
+		}
+
+		t, err := e.open(e.ctx)
+		if err != nil {
+			cause = err
+			continue
+		}
+
+		if !e.setConnection(t) {
+			// Client was closed while we were dialing
+			t.Close()
+			return false
+		}
+
+		return true
+	}
+
+	e.setState(ConnectionStateGaveUp)
+	e.errC <- errors.Wrapf(ErrReconnectFailed, "Gave up after %d attempts (last error: %s)", e.cfg.Reconnect.Attempts, cause)
+	return false
+}
+
+// resetHeartbeat restarts the timer declaring the connection dead. It
+// is a no-op until the timeout is known from the handshake.
+func (e *EIOClient) resetHeartbeat() {
+	e.connLock.Lock()
+	defer e.connLock.Unlock()
+
+	if e.heartbeatTimeout <= 0 || e.closed {
+		return
+	}
+
+	e.stopHeartbeat()
+
+	seq, timeout := e.heartbeatSeq, e.heartbeatTimeout
+	e.heartbeat = time.AfterFunc(timeout, func() { e.heartbeatExpired(seq, timeout) })
+}
+
+func (e *EIOClient) heartbeatExpired(seq uint64, timeout time.Duration) {
+	e.connLock.Lock()
+	if seq != e.heartbeatSeq || e.closed {
+		e.connLock.Unlock()
+		return
+	}
+
+	err := PingTimeoutError{Timeout: timeout}
+	e.deadCause = err
+	e.heartbeat = nil
+	t := e.transport
+	e.connLock.Unlock()
+
+	e.errC <- err
+
+	// Unblocks the read loop which then handles the lost connection
+	t.Close()
+}
+
+// stopHeartbeat must be called with connLock held
+func (e *EIOClient) stopHeartbeat() {
+	e.heartbeatSeq++
+	if e.heartbeat != nil {
+		e.heartbeat.Stop()
+		e.heartbeat = nil
+	}
+}
+
+func (e *EIOClient) send(p eioPacket) error {
+	e.connLock.RLock()
+	t, state := e.transport, e.state
+	e.connLock.RUnlock()
+
+	if state != ConnectionStateConnected {
+		return ErrNotConnected
+	}
+
+	return errors.Wrap(t.Write(p), "Unable to transmit message")
+}
+
+// setConnection replaces the transport and marks the client connected
+// unless it was closed in the meantime
+func (e *EIOClient) setConnection(t transport) bool {
+	e.connLock.Lock()
+	if e.closed {
+		e.connLock.Unlock()
+		return false
+	}
+	e.transport = t
+	e.connLock.Unlock()
+
+	e.setState(ConnectionStateConnected)
+	return true
+}
+
+func (e *EIOClient) setState(state ConnectionState) {
+	e.connLock.Lock()
+	changed := e.state != state
+	e.state = state
+	e.connLock.Unlock()
+
+	if changed && e.cfg.StateHandler != nil {
+		e.cfg.StateHandler(state)
+	}
+}
+
+func (e *EIOClient) startPinger(interval time.Duration) {
+	e.connLock.Lock()
+	defer e.connLock.Unlock()
+
+	e.stopPinger()
+
+	stop := make(chan struct{})
+	e.pingerStop = stop
+
+	e.pingerWG.Add(1)
+	go func() {
+		defer e.pingerWG.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			e.SendTextMessage(EIOMessageTypePing, "")
+
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// stopPinger must be called with connLock held
+func (e *EIOClient) stopPinger() {
+	if e.pingerStop != nil {
+		close(e.pingerStop)
+		e.pingerStop = nil
+	}
+}
+
+// transportURL builds the URL to use for the given transport, switching
+// the scheme between HTTP and websocket as required
+func (e *EIOClient) transportURL(name, sid string) *url.URL {
+	u := *e.socketURL
+
+	switch {
+	case name == TransportWebsocket && u.Scheme == "http":
+		u.Scheme = "ws"
+	case name == TransportWebsocket && u.Scheme == "https":
+		u.Scheme = "wss"
+	case name == TransportPolling && u.Scheme == "ws":
+		u.Scheme = "http"
+	case name == TransportPolling && u.Scheme == "wss":
+		u.Scheme = "https"
+	}
+
+	qVars := u.Query()
+	qVars.Set("transport", name)
+	if sid != "" {
+		qVars.Set("sid", sid)
+	}
+	if name == TransportPolling && e.cfg.Version == EIOVersion3 {
+		// Request binary data to be base64 encoded instead of using the
+		// binary payload format
+		qVars.Set("b64", "1")
+	}
+	u.RawQuery = qVars.Encode()
+
+	return &u
+}
+
+func decodeTextPacket(data []byte) (eioPacket, error) {
+	if len(data) < 1 {
+		return eioPacket{}, errors.New("Empty message received")
+	}
+
+	v, err := strconv.Atoi(string(data[0]))
+	if err != nil {
+		return eioPacket{}, errors.Wrap(err, "Unable to parse message type")
+	}
+
+	return eioPacket{Type: EIOMessageType(v), Data: data[1:]}, nil
+}
@@ -0,0 +1,577 @@
+package sioclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer emulates a minimal Socket.IO server speaking the protocol
+// version and transport requested by the client and recording all
+// frames it receives
+type testServer struct {
+	*httptest.Server
+
+	connections int32
+	received    chan string
+
+	sessions     map[string]*testSession
+	sessionsLock sync.Mutex
+
+	// closeAfterHello makes the server drop the first connection after
+	// the hello event has been sent
+	closeAfterHello bool
+	// pingTimeout is announced in the handshake (ms, defaults to 1000)
+	pingTimeout int
+	// requestCheck rejects requests not matching it when set
+	requestCheck func(*http.Request) bool
+	// silent makes the server stop answering pings (v3) to emulate a
+	// half-open connection. In v4 the server pings only once anyway.
+	silent bool
+}
+
+type testSession struct {
+	closeAfterHello bool
+	out             chan string
+	version         int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := newUnstartedTestServer(t)
+	s.Start()
+	return s
+}
+
+func newTLSTestServer(t *testing.T) *testServer {
+	s := newUnstartedTestServer(t)
+	s.StartTLS()
+	return s
+}
+
+func newUnstartedTestServer(t *testing.T) *testServer {
+	s := &testServer{
+		received: make(chan string, 100),
+		sessions: map[string]*testSession{},
+	}
+
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.requestCheck != nil && !s.requestCheck(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		version, err := strconv.Atoi(r.URL.Query().Get("EIO"))
+		if err != nil {
+			http.Error(w, "invalid EIO version", http.StatusBadRequest)
+			return
+		}
+
+		sess := s.session(r.URL.Query().Get("sid"), version)
+		if sess == nil {
+			http.Error(w, `{"code":1,"message":"Session ID unknown"}`, http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Query().Get("transport") == TransportPolling {
+			s.servePolling(w, r, sess)
+			return
+		}
+
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Unable to upgrade connection: %s", err)
+			return
+		}
+		defer conn.Close()
+
+		if r.URL.Query().Get("sid") != "" && !s.probe(conn) {
+			return
+		}
+
+		s.serveWebsocket(conn, sess)
+	}))
+
+	return s
+}
+
+func (s *testServer) URL() string {
+	return "ws" + strings.TrimPrefix(s.Server.URL, "http") + "/socket.io/"
+}
+
+// handle executes the server side of the protocol for a received frame
+func (s *testServer) handle(sess *testSession, msg string) {
+	s.received <- msg
+
+	switch {
+	case sess.version == EIOVersion3 && msg == "2" && !s.silent:
+		sess.out <- "3"
+
+	case strings.HasPrefix(msg, "40/"):
+		// Accept every namespace besides the default one
+		ns := strings.SplitN(msg[2:], ",", 2)[0]
+		sess.out <- "40" + ns + `,{"sid":"nsp-test"}`
+
+	case sess.version == EIOVersion4 && strings.HasPrefix(msg, "40"):
+		sess.out <- `40{"sid":"nsp-test"}`
+		sess.out <- sess.hello()
+
+	case strings.HasPrefix(msg, "42"):
+		// Acknowledge "echo" events with their arguments
+		m, _, err := decodePacket([]byte(msg[1:]))
+		if err != nil || m.ID == 0 {
+			return
+		}
+
+		if pt, _ := m.PayloadType(); pt == "echo" {
+			ack := Message{Type: MessageTypeAck, Namespace: m.Namespace, ID: m.ID, Payload: m.Payload[1:]}
+			raw, _ := ack.Encode()
+			sess.out <- "4" + raw
+		}
+	}
+}
+
+func (s *testServer) probe(conn *websocket.Conn) bool {
+	for _, expected := range []string{"2probe", "5"} {
+		_, msg, err := conn.ReadMessage()
+		if err != nil || string(msg) != expected {
+			return false
+		}
+		s.received <- string(msg)
+
+		if expected == "2probe" && conn.WriteMessage(websocket.TextMessage, []byte("3probe")) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *testServer) serveWebsocket(conn *websocket.Conn, sess *testSession) {
+	go func() {
+		for msg := range sess.out {
+			if conn.WriteMessage(websocket.TextMessage, []byte(msg)) != nil {
+				return
+			}
+
+			if sess.closeAfterHello && msg == sess.hello() {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.handle(sess, string(msg))
+	}
+}
+
+func (s *testServer) servePolling(w http.ResponseWriter, r *http.Request, sess *testSession) {
+	if r.Method == http.MethodPost {
+		body, _ := ioutil.ReadAll(r.Body)
+		packets, err := decodePayload(body, sess.version)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, p := range packets {
+			s.handle(sess, strconv.Itoa(int(p.Type))+string(p.Data))
+		}
+
+		w.Write([]byte("ok"))
+		return
+	}
+
+	var packets []eioPacket
+	select {
+	case msg := <-sess.out:
+		p, _ := decodeTextPacket([]byte(msg))
+		packets = append(packets, p)
+	case <-time.After(100 * time.Millisecond):
+		packets = append(packets, eioPacket{Type: EIOMessageTypeNoop})
+	}
+
+	w.Write(encodePayload(packets, sess.version))
+}
+
+// session returns the session for the given ID or creates a new one
+// if no ID is given
+func (s *testServer) session(sid string, version int) *testSession {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	if sid != "" {
+		return s.sessions[sid]
+	}
+
+	n := atomic.AddInt32(&s.connections, 1)
+	sess := &testSession{
+		closeAfterHello: s.closeAfterHello && n == 1,
+		out:             make(chan string, 100),
+		version:         version,
+	}
+
+	sid = "session" + strconv.Itoa(int(n))
+	s.sessions[sid] = sess
+
+	pingTimeout := s.pingTimeout
+	if pingTimeout == 0 {
+		pingTimeout = 1000
+	}
+
+	sess.out <- `0{"sid":"` + sid + `","upgrades":["websocket"],"pingInterval":50,"pingTimeout":` + strconv.Itoa(pingTimeout) + `}`
+	if version == EIOVersion3 {
+		// Socket.IO v2 connects the client to the default namespace
+		sess.out <- "40"
+		sess.out <- sess.hello()
+	} else {
+		// Socket.IO v3+ expects the server to ping
+		sess.out <- "2"
+	}
+
+	return sess
+}
+
+func (t *testSession) hello() string {
+	return `42["hello",{"version":` + strconv.Itoa(t.version) + `}]`
+}
+
+func (s *testServer) expectFrame(t *testing.T, expected string) {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-s.received:
+			if msg == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Server did not receive frame %q", expected)
+		}
+	}
+}
+
+func expectHello(t *testing.T, msgs <-chan *Message, version int) {
+	t.Helper()
+
+	select {
+	case msg := <-msgs:
+		var payload struct {
+			Version int `json:"version"`
+		}
+
+		if pt, err := msg.PayloadType(); err != nil || pt != "hello" {
+			t.Fatalf("Expected hello event, got %q (%v)", pt, err)
+		}
+		if err := msg.UnmarshalPayload(&payload); err != nil {
+			t.Fatalf("Unable to unmarshal payload: %s", err)
+		}
+		if payload.Version != version {
+			t.Errorf("Expected server to speak version %d, got %d", version, payload.Version)
+		}
+
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not receive hello event")
+	}
+}
+
+func eventCollector(msgs chan<- *Message) func(*Message) error {
+	return func(m *Message) error {
+		if m.Type == MessageTypeEvent {
+			msgs <- m
+		}
+		return nil
+	}
+}
+
+func TestProtocolVersions(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		version        int
+		expectedFrames []string
+	}{
+		{
+			name:    "default to v3",
+			version: 0,
+			// Client has to ping the server
+			expectedFrames: []string{"2"},
+		},
+		{
+			name:           "v3",
+			version:        EIOVersion3,
+			expectedFrames: []string{"2"},
+		},
+		{
+			name:    "v4",
+			version: EIOVersion4,
+			// Client has to connect the default namespace with auth and
+			// to answer the ping sent by the server
+			expectedFrames: []string{`40{"token":"secret"}`, "3"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			defer srv.Close()
+
+			msgs := make(chan *Message, 10)
+			client, err := New(Config{
+				Auth:           map[string]string{"token": "secret"},
+				EIOVersion:     tc.version,
+				MessageHandler: eventCollector(msgs),
+				URL:            srv.URL(),
+			})
+			if err != nil {
+				t.Fatalf("Unable to create client: %s", err)
+			}
+			defer client.Close()
+
+			for _, f := range tc.expectedFrames {
+				srv.expectFrame(t, f)
+			}
+
+			expectedVersion := tc.version
+			if expectedVersion == 0 {
+				expectedVersion = EIOVersion3
+			}
+			expectHello(t, msgs, expectedVersion)
+		})
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	if _, err := NewEIOClient(EIOClientConfig{URL: "ws://localhost/", Version: 2}); err == nil {
+		t.Error("Expected error for unsupported version")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	for _, version := range []int{EIOVersion3, EIOVersion4} {
+		t.Run("v"+strconv.Itoa(version), func(t *testing.T) {
+			srv := newTestServer(t)
+			srv.closeAfterHello = true
+			defer srv.Close()
+
+			var (
+				msgs   = make(chan *Message, 10)
+				states = make(chan ConnectionState, 10)
+			)
+
+			client, err := New(Config{
+				EIOVersion:     version,
+				MessageHandler: eventCollector(msgs),
+				Reconnect: ReconnectConfig{
+					Attempts:   3,
+					BackoffMin: 10 * time.Millisecond,
+					BackoffMax: 20 * time.Millisecond,
+				},
+				StateHandler: func(s ConnectionState) { states <- s },
+				URL:          srv.URL(),
+			})
+			if err != nil {
+				t.Fatalf("Unable to create client: %s", err)
+			}
+			defer client.Close()
+
+			// Hello from the first and the second session
+			expectHello(t, msgs, version)
+			expectHello(t, msgs, version)
+
+			for _, expected := range []ConnectionState{
+				ConnectionStateConnected,
+				ConnectionStateReconnecting,
+				ConnectionStateConnected,
+			} {
+				select {
+				case s := <-states:
+					if s != expected {
+						t.Errorf("Expected state %s, got %s", expected, s)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("Did not receive state %s", expected)
+				}
+			}
+		})
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	for _, version := range []int{EIOVersion3, EIOVersion4} {
+		t.Run("v"+strconv.Itoa(version), func(t *testing.T) {
+			srv := newTestServer(t)
+			srv.pingTimeout = 100
+			srv.silent = true
+			defer srv.Close()
+
+			states := make(chan ConnectionState, 10)
+			client, err := New(Config{
+				EIOVersion:     version,
+				MessageHandler: func(*Message) error { return nil },
+				StateHandler:   func(s ConnectionState) { states <- s },
+				URL:            srv.URL(),
+			})
+			if err != nil {
+				t.Fatalf("Unable to create client: %s", err)
+			}
+			defer client.Close()
+
+			select {
+			case err := <-client.EIO.Errors():
+				if pErr, ok := err.(PingTimeoutError); !ok || pErr.Timeout != 150*time.Millisecond {
+					t.Fatalf("Expected ping timeout error, got %#v", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Dead connection was not detected")
+			}
+
+			for _, expected := range []ConnectionState{ConnectionStateConnected, ConnectionStateGaveUp} {
+				select {
+				case s := <-states:
+					if s != expected {
+						t.Errorf("Expected state %s, got %s", expected, s)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("Did not receive state %s", expected)
+				}
+			}
+
+			select {
+			case <-client.Done():
+			case <-time.After(time.Second):
+				t.Fatal("Client did not stop after giving up")
+			}
+
+			if client.EIO.ctx.Err() == nil {
+				t.Error("Expected context of the connection to be cancelled")
+			}
+
+			if s := client.EIO.State(); s != ConnectionStateGaveUp {
+				t.Errorf("Expected client to stay in state %s, got %s", ConnectionStateGaveUp, s)
+			}
+		})
+	}
+}
+
+func TestTransports(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		version           int
+		transport         string
+		upgrade           bool
+		expectedTransport string
+	}{
+		{"v3 websocket", EIOVersion3, TransportWebsocket, false, TransportWebsocket},
+		{"v3 polling", EIOVersion3, TransportPolling, false, TransportPolling},
+		{"v3 polling upgrade", EIOVersion3, TransportPolling, true, TransportWebsocket},
+		{"v4 websocket", EIOVersion4, TransportWebsocket, false, TransportWebsocket},
+		{"v4 polling", EIOVersion4, TransportPolling, false, TransportPolling},
+		{"v4 polling upgrade", EIOVersion4, TransportPolling, true, TransportWebsocket},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			defer srv.Close()
+
+			msgs := make(chan *Message, 10)
+			client, err := New(Config{
+				EIOVersion:     tc.version,
+				MessageHandler: eventCollector(msgs),
+				Transport:      tc.transport,
+				Upgrade:        tc.upgrade,
+				URL:            srv.URL(),
+			})
+			if err != nil {
+				t.Fatalf("Unable to create client: %s", err)
+			}
+			defer client.Close()
+
+			if tc.upgrade {
+				srv.expectFrame(t, "5")
+			}
+
+			expectHello(t, msgs, tc.version)
+
+			if tr := client.EIO.Transport(); tr != tc.expectedTransport {
+				t.Errorf("Expected transport %q, got %q", tc.expectedTransport, tr)
+			}
+
+			// Pings (v3) and pongs (v4) must be sent over the active transport
+			if tc.version == EIOVersion3 {
+				srv.expectFrame(t, "2")
+			} else {
+				srv.expectFrame(t, "3")
+			}
+		})
+	}
+}
+
+func TestContextLifecycle(t *testing.T) {
+	for _, transport := range []string{TransportWebsocket, TransportPolling} {
+		t.Run(transport, func(t *testing.T) {
+			srv := newTestServer(t)
+			defer srv.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			msgs := make(chan *Message, 10)
+			client, err := NewWithContext(ctx, Config{
+				MessageHandler: eventCollector(msgs),
+				Transport:      transport,
+				URL:            srv.URL(),
+			})
+			if err != nil {
+				t.Fatalf("Unable to create client: %s", err)
+			}
+
+			expectHello(t, msgs, EIOVersion3)
+			cancel()
+
+			select {
+			case <-client.Done():
+			case <-time.After(time.Second):
+				t.Fatal("Client did not stop after cancelling the context")
+			}
+
+			// Engine.IO close packet
+			srv.expectFrame(t, "1")
+
+			if s := client.EIO.State(); s != ConnectionStateDisconnected {
+				t.Errorf("Expected client to be disconnected, got %s", s)
+			}
+
+			if err = client.Dial(); err == nil {
+				t.Error("Expected closed client not to dial again")
+			}
+		})
+	}
+}
+
+func TestCloseUnconnected(t *testing.T) {
+	client, err := NewClient(Config{URL: "ws://localhost/socket.io/"})
+	if err != nil {
+		t.Fatalf("Unable to create client: %s", err)
+	}
+
+	if err = client.Close(); err != nil {
+		t.Errorf("Unable to close client: %s", err)
+	}
+
+	select {
+	case <-client.Done():
+	default:
+		t.Error("Expected unconnected client to be done after close")
+	}
+}
@@ -0,0 +1,201 @@
+package sioclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type HandlerID uint64
+
+type eventHandler struct {
+	fn   reflect.Value
+	id   HandlerID
+	once bool
+}
+
+type eventRegistry struct {
+	handlers map[string][]*eventHandler
+	lastID   HandlerID
+	lock     sync.Mutex
+}
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	messageType = reflect.TypeOf((*Message)(nil))
+)
+
+// On registers a handler for the given event on the default namespace,
+// see Namespace.On
+func (c *Client) On(event string, handler interface{}) HandlerID {
+	return c.Of(defaultNamespace).On(event, handler)
+}
+
+// Once registers a handler on the default namespace, see Namespace.Once
+func (c *Client) Once(event string, handler interface{}) HandlerID {
+	return c.Of(defaultNamespace).Once(event, handler)
+}
+
+// Off removes handlers from the default namespace, see Namespace.Off
+func (c *Client) Off(event string, ids ...HandlerID) {
+	c.Of(defaultNamespace).Off(event, ids...)
+}
+
+// On registers a handler for the given event and returns an ID to
+// remove it using Off. Multiple handlers per event are called in the
+// order of their registration.
+//
+// The handler must be a function optionally returning an error. Its
+// arguments are decoded from the event arguments in order using
+// encoding/json, missing arguments are passed as zero values. An
+// argument of type *Message receives the raw message instead:
+//
+//	ns.On("init", func(data initMessage) error { ... })
+//	ns.On("names", func(msg *sioclient.Message) error { ... })
+//
+// Besides the events sent by the server the reserved events
+// EventConnect, EventConnectError and EventDisconnect are dispatched.
+//
+// On panics if the handler is not a function of that kind.
+func (n *Namespace) On(event string, handler interface{}) HandlerID {
+	return n.events.add(event, handler, false)
+}
+
+// Once works like On but removes the handler after its first call
+func (n *Namespace) Once(event string, handler interface{}) HandlerID {
+	return n.events.add(event, handler, true)
+}
+
+// Off removes the handlers with the given IDs from the event. If no IDs
+// are given all handlers of the event are removed.
+func (n *Namespace) Off(event string, ids ...HandlerID) {
+	n.events.remove(event, ids...)
+}
+
+func (e *eventRegistry) add(event string, handler interface{}, once bool) HandlerID {
+	fn := reflect.ValueOf(handler)
+	if err := validateHandler(fn.Type()); err != nil {
+		panic(errors.Wrapf(err, "Invalid handler for event %q", event))
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.handlers == nil {
+		e.handlers = map[string][]*eventHandler{}
+	}
+
+	e.lastID++
+	e.handlers[event] = append(e.handlers[event], &eventHandler{fn: fn, id: e.lastID, once: once})
+
+	return e.lastID
+}
+
+// dispatch calls all handlers registered for the event contained in
+// the message and stops at the first handler returning an error
+func (e *eventRegistry) dispatch(m *Message) error {
+	event, err := m.PayloadType()
+	if err != nil {
+		return err
+	}
+
+	e.lock.Lock()
+	var (
+		handlers = append([]*eventHandler(nil), e.handlers[event]...)
+		retained []*eventHandler
+	)
+	for _, h := range handlers {
+		if !h.once {
+			retained = append(retained, h)
+		}
+	}
+	if len(retained) != len(handlers) {
+		e.handlers[event] = retained
+	}
+	e.lock.Unlock()
+
+	for _, h := range handlers {
+		if err := h.call(m); err != nil {
+			return errors.Wrapf(err, "Handler for event %q failed", event)
+		}
+	}
+
+	return nil
+}
+
+func (e *eventRegistry) remove(event string, ids ...HandlerID) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if len(ids) == 0 {
+		delete(e.handlers, event)
+		return
+	}
+
+	var retained []*eventHandler
+	for _, h := range e.handlers[event] {
+		var drop bool
+		for _, id := range ids {
+			drop = drop || h.id == id
+		}
+
+		if !drop {
+			retained = append(retained, h)
+		}
+	}
+
+	e.handlers[event] = retained
+}
+
+func (h eventHandler) call(m *Message) error {
+	var (
+		fnType = h.fn.Type()
+		args   = make([]reflect.Value, fnType.NumIn())
+	)
+
+	for i := range args {
+		argType := fnType.In(i)
+
+		if argType == messageType {
+			args[i] = reflect.ValueOf(m)
+			continue
+		}
+
+		v := reflect.New(argType)
+		// Payload[0] is the event name
+		if i+1 < len(m.Payload) {
+			if err := json.Unmarshal(m.Payload[i+1], v.Interface()); err != nil {
+				return errors.Wrapf(err, "Unable to decode argument %d", i)
+			}
+		}
+		args[i] = v.Elem()
+	}
+
+	out := h.fn.Call(args)
+	if len(out) == 0 || out[0].IsNil() {
+		return nil
+	}
+
+	return out[0].Interface().(error)
+}
+
+func validateHandler(t reflect.Type) error {
+	if t.Kind() != reflect.Func {
+		return errors.New("Handler is no function")
+	}
+
+	if t.IsVariadic() {
+		return errors.New("Handler must not be variadic")
+	}
+
+	switch {
+	case t.NumOut() == 0:
+	case t.NumOut() == 1 && t.Out(0) == errorType:
+	default:
+		return errors.New("Handler may only return an error")
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package sioclient
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEventHandlers(t *testing.T) {
+	var (
+		calls []string
+		reg   eventRegistry
+	)
+
+	type payload struct {
+		Name string `json:"name"`
+	}
+
+	reg.add("test", func(p payload, n int) error {
+		calls = append(calls, "typed:"+p.Name)
+		if n != 42 {
+			t.Errorf("Expected second argument to be 42, got %d", n)
+		}
+		return nil
+	}, false)
+	reg.add("test", func(m *Message) { calls = append(calls, "raw:"+string(m.Payload[0])) }, false)
+	reg.add("test", func() { calls = append(calls, "once") }, true)
+	offID := reg.add("test", func() { calls = append(calls, "removed") }, false)
+	reg.add("other", func() { calls = append(calls, "other") }, false)
+
+	reg.remove("test", offID)
+
+	msg, err := newEventMessage("/", 0, "test", map[string]string{"name": "foo"}, 42)
+	if err != nil {
+		t.Fatalf("Unable to create message: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = reg.dispatch(msg); err != nil {
+			t.Fatalf("Dispatch failed: %s", err)
+		}
+	}
+
+	expected := []string{
+		"typed:foo", `raw:"test"`, "once",
+		"typed:foo", `raw:"test"`,
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Unexpected handler calls: %v", calls)
+	}
+
+	reg.remove("test")
+	if err = reg.dispatch(msg); err != nil || len(calls) != len(expected) {
+		t.Errorf("Expected no handlers to be called after removal")
+	}
+}
+
+func TestEventHandlerErrors(t *testing.T) {
+	var reg eventRegistry
+
+	reg.add("test", func() error { return errors.New("failed") }, false)
+	reg.add("decode", func(n int) error { return nil }, false)
+
+	for _, event := range []string{"test", "decode"} {
+		msg, _ := newEventMessage("/", 0, event, "not a number")
+		if err := reg.dispatch(msg); err == nil {
+			t.Errorf("Expected dispatch of %q to fail", event)
+		}
+	}
+}
+
+func TestInvalidEventHandlers(t *testing.T) {
+	for _, handler := range []interface{}{
+		"no function",
+		func() int { return 0 },
+		func(...int) {},
+		func() (error, error) { return nil, nil },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected registration of %T to panic", handler)
+				}
+			}()
+
+			new(eventRegistry).add("test", handler, false)
+		}()
+	}
+}
@@ -0,0 +1,159 @@
+package sioclient
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const defaultNamespace = "/"
+
+// Reserved events dispatched to the handlers of a namespace when the
+// server answers the CONNECT packet or disconnects the namespace
+const (
+	EventConnect      = "connect"
+	EventConnectError = "connect_error"
+	EventDisconnect   = "disconnect"
+)
+
+// Namespace is a multiplexed channel on the connection of the client
+// with its own event handlers and acknowledgements
+type Namespace struct {
+	acks   ackRegistry
+	client *Client
+	events eventRegistry
+	name   string
+}
+
+type namespaceRegistry struct {
+	namespaces map[string]*Namespace
+	// opened is set as soon as the Engine.IO handshake of the current
+	// session was handled and CONNECT packets can be sent
+	opened bool
+	lock   sync.Mutex
+}
+
+// Of returns the namespace with the given name and connects to it if
+// this did not happen before. The namespace is connected again after
+// every reconnect.
+func (c *Client) Of(namespace string) *Namespace {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	c.namespaces.lock.Lock()
+	if ns, ok := c.namespaces.namespaces[namespace]; ok {
+		c.namespaces.lock.Unlock()
+		return ns
+	}
+
+	ns := &Namespace{client: c, name: namespace}
+	c.namespaces.namespaces[namespace] = ns
+	opened := c.namespaces.opened
+	c.namespaces.lock.Unlock()
+
+	if opened {
+		// Errors are not fatal here: the CONNECT packet is sent again
+		// after the next handshake
+		ns.connect()
+	}
+
+	return ns
+}
+
+// Disconnect leaves the namespace and removes it from the client
+func (n *Namespace) Disconnect() error {
+	n.client.namespaces.lock.Lock()
+	delete(n.client.namespaces.namespaces, n.name)
+	n.client.namespaces.lock.Unlock()
+
+	return (&Message{Type: MessageTypeDisconnect, Namespace: n.name}).Send(n.client)
+}
+
+// Name returns the name of the namespace including the leading slash
+func (n *Namespace) Name() string { return n.name }
+
+func (n *Namespace) connect() error {
+	msg := &Message{Type: MessageTypeConnect, Namespace: n.name}
+
+	if n.client.cfg.Auth != nil && n.client.EIO.cfg.Version >= EIOVersion4 {
+		auth, err := json.Marshal(n.client.cfg.Auth)
+		if err != nil {
+			return errors.Wrap(err, "Unable to marshal auth payload")
+		}
+		msg.Payload = []json.RawMessage{auth}
+	}
+
+	return msg.Send(n.client)
+}
+
+// handleMessage routes an incoming message into the namespace
+func (n *Namespace) handleMessage(m *Message) (bool, error) {
+	switch m.Type {
+
+	case MessageTypeAck, MessageTypeBinaryAck:
+		return n.acks.resolve(m), nil
+
+	case MessageTypeEvent, MessageTypeBinaryEvent:
+		return true, n.events.dispatch(m)
+
+	case MessageTypeConnect:
+		return true, n.dispatchReserved(EventConnect, m)
+
+	case MessageTypeError:
+		return true, n.dispatchReserved(EventConnectError, m)
+
+	case MessageTypeDisconnect:
+		return true, n.dispatchReserved(EventDisconnect, m)
+
+	}
+
+	return false, nil
+}
+
+// dispatchReserved passes the payload of a non-event message into the
+// handlers of the given reserved event
+func (n *Namespace) dispatchReserved(event string, m *Message) error {
+	name, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "Unable to marshal event name")
+	}
+
+	evt := *m
+	evt.Payload = append([]json.RawMessage{name}, m.Payload...)
+
+	return n.events.dispatch(&evt)
+}
+
+// handleOpen sends the CONNECT packets for all namespaces after the
+// handshake of a new Engine.IO session
+func (c *Client) handleOpen() error {
+	c.namespaces.lock.Lock()
+	c.namespaces.opened = true
+	var namespaces []*Namespace
+	for _, ns := range c.namespaces.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	c.namespaces.lock.Unlock()
+
+	for _, ns := range namespaces {
+		if ns.name == defaultNamespace && c.EIO.cfg.Version < EIOVersion4 {
+			// Up to EIO v3 the server connects us to the default namespace
+			continue
+		}
+
+		if err := ns.connect(); err != nil {
+			return errors.Wrapf(err, "Unable to connect namespace %q", ns.name)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) namespace(name string) *Namespace {
+	c.namespaces.lock.Lock()
+	defer c.namespaces.lock.Unlock()
+
+	return c.namespaces.namespaces[name]
+}
@@ -0,0 +1,63 @@
+package sioclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNamespaces(t *testing.T) {
+	for _, version := range []int{EIOVersion3, EIOVersion4} {
+		srv := newTestServer(t)
+
+		client, err := NewClient(Config{EIOVersion: version, URL: srv.URL()})
+		if err != nil {
+			t.Fatalf("Unable to create client: %s", err)
+		}
+
+		var (
+			chat      = client.Of("/chat")
+			connected = make(chan string, 1)
+		)
+		chat.On(EventConnect, func(data struct {
+			SID string `json:"sid"`
+		}) {
+			connected <- data.SID
+		})
+
+		if err = client.Dial(); err != nil {
+			t.Fatalf("Unable to connect client: %s", err)
+		}
+
+		select {
+		case sid := <-connected:
+			if sid != "nsp-test" {
+				t.Errorf("Unexpected namespace SID %q", sid)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Namespace was not connected using EIO v%d", version)
+		}
+
+		if client.Of("/chat") != chat {
+			t.Error("Expected Of to return the existing namespace")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		args, err := chat.EmitWithAck(ctx, "echo", "chat")
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Unable to emit into namespace: %s", err)
+		}
+		if len(args) != 1 || string(args[0]) != `"chat"` {
+			t.Errorf("Unexpected acknowledgement: %s", args)
+		}
+
+		if l := len(client.Of("/").acks.pending); l != 0 {
+			t.Errorf("Expected default namespace to be untouched, got %d pending", l)
+		}
+
+		client.Close()
+		srv.Close()
+	}
+}
@@ -0,0 +1,232 @@
+package sioclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Decoder reassembles messages from text packets and the binary
+// attachments following binary events / acks. It is not safe for
+// concurrent use.
+type Decoder struct {
+	pending *Message
+	missing int
+}
+
+type placeholder struct {
+	Placeholder bool `json:"_placeholder"`
+	Num         int  `json:"num"`
+}
+
+// Placeholder returns the JSON to put into the payload of a binary
+// message instead of the data of the attachment with the given index
+func Placeholder(num int) json.RawMessage {
+	raw, _ := json.Marshal(placeholder{Placeholder: true, Num: num})
+	return raw
+}
+
+// DecodeText parses a text packet. For binary messages nil is returned
+// until all attachments have been passed to DecodeBinary.
+func (d *Decoder) DecodeText(data []byte) (*Message, error) {
+	if d.pending != nil {
+		d.pending = nil
+		return nil, errors.New("Received text packet while waiting for binary attachments")
+	}
+
+	m, attachments, err := decodePacket(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if attachments == 0 {
+		return m, errors.Wrap(m.reconstitute(), "Unable to reconstitute binary data")
+	}
+
+	d.pending, d.missing = m, attachments
+	return nil, nil
+}
+
+// DecodeBinary adds an attachment to the pending binary message and
+// returns it as soon as it is complete
+func (d *Decoder) DecodeBinary(data []byte) (*Message, error) {
+	if d.pending == nil {
+		return nil, errors.New("Received unexpected binary attachment")
+	}
+
+	d.pending.Attachments = append(d.pending.Attachments, append([]byte(nil), data...))
+	if d.missing--; d.missing > 0 {
+		return nil, nil
+	}
+
+	m := d.pending
+	d.pending = nil
+
+	return m, errors.Wrap(m.reconstitute(), "Unable to reconstitute binary data")
+}
+
+// decodePacket parses a packet in the format
+//
+//	<type>[<attachments>-][<namespace>,][<id>][<data>]
+//
+// and returns the message with the number of binary attachments to
+// expect
+func decodePacket(data []byte) (*Message, int, error) {
+	var (
+		m           = &Message{Namespace: "/"}
+		attachments int
+		ptr         int
+	)
+
+	if len(data) < 1 {
+		return nil, 0, errors.New("Message was empty")
+	}
+
+	if data[0] < '0' || data[0] > byte('0'+MessageTypeBinaryAck) {
+		return nil, 0, errors.Errorf("Invalid message type %q", data[0])
+	}
+	m.Type = MessageType(data[0] - '0')
+	ptr++
+
+	if m.Type == MessageTypeBinaryEvent || m.Type == MessageTypeBinaryAck {
+		sep := bytes.IndexByte(data[ptr:], '-')
+		if sep < 1 {
+			return nil, 0, errors.New("Binary message is missing number of attachments")
+		}
+
+		var err error
+		if attachments, err = strconv.Atoi(string(data[ptr : ptr+sep])); err != nil {
+			return nil, 0, errors.Wrap(err, "Unable to parse number of attachments")
+		}
+		ptr += sep + 1
+	}
+
+	if ptr < len(data) && data[ptr] == '/' {
+		end := bytes.IndexByte(data[ptr:], ',')
+		if end < 0 {
+			// Namespace without data (i.e. "1/chat")
+			end = len(data) - ptr
+		}
+
+		m.Namespace = string(data[ptr : ptr+end])
+		ptr += end
+		if ptr < len(data) {
+			// Skip the comma
+			ptr++
+		}
+	}
+
+	idEnd := ptr
+	for idEnd < len(data) && data[idEnd] >= '0' && data[idEnd] <= '9' {
+		idEnd++
+	}
+	if idEnd > ptr {
+		var err error
+		if m.ID, err = strconv.Atoi(string(data[ptr:idEnd])); err != nil {
+			return nil, 0, errors.Wrap(err, "Unable to parse message ID")
+		}
+		ptr = idEnd
+	}
+
+	payload := data[ptr:]
+	if len(payload) == 0 {
+		if m.Type == MessageTypeEvent || m.Type == MessageTypeBinaryEvent {
+			return nil, 0, errors.New("Event is missing payload")
+		}
+		return m, attachments, nil
+	}
+
+	if !json.Valid(payload) {
+		return nil, 0, errors.New("Payload is no valid JSON")
+	}
+
+	switch m.Type {
+
+	case MessageTypeConnect, MessageTypeError:
+		// Carry a single object (connect, v4 error) or string (v3 error)
+		// instead of a list of arguments
+		m.Payload = []json.RawMessage{append(json.RawMessage(nil), payload...)}
+
+	case MessageTypeDisconnect:
+		return nil, 0, errors.New("Disconnect must not carry a payload")
+
+	default:
+		if err := json.Unmarshal(payload, &m.Payload); err != nil {
+			return nil, 0, errors.Wrap(err, "Unable to unmarshal message")
+		}
+
+		if m.Type == MessageTypeEvent || m.Type == MessageTypeBinaryEvent {
+			if _, err := m.PayloadType(); err != nil {
+				return nil, 0, errors.Wrap(err, "Event is missing name")
+			}
+		}
+
+	}
+
+	return m, attachments, nil
+}
+
+// reconstitute replaces the placeholders in the payload by the base64
+// encoded attachments so they can be unmarshalled into []byte
+func (m *Message) reconstitute() error {
+	if len(m.Attachments) == 0 {
+		return nil
+	}
+
+	for i, raw := range m.Payload {
+		var v interface{}
+
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return errors.Wrap(err, "Unable to decode payload")
+		}
+
+		v, err := m.replacePlaceholders(v)
+		if err != nil {
+			return err
+		}
+
+		if m.Payload[i], err = json.Marshal(v); err != nil {
+			return errors.Wrap(err, "Unable to encode payload")
+		}
+	}
+
+	return nil
+}
+
+func (m *Message) replacePlaceholders(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+
+	case []interface{}:
+		for i := range t {
+			var err error
+			if t[i], err = m.replacePlaceholders(t[i]); err != nil {
+				return nil, err
+			}
+		}
+
+	case map[string]interface{}:
+		if p, ok := t["_placeholder"].(bool); ok && p {
+			n, _ := t["num"].(json.Number)
+			num, err := n.Int64()
+			if err != nil || num < 0 || int(num) >= len(m.Attachments) {
+				return nil, errors.Errorf("Invalid placeholder %v", t["num"])
+			}
+			return base64.StdEncoding.EncodeToString(m.Attachments[num]), nil
+		}
+
+		for k := range t {
+			var err error
+			if t[k], err = m.replacePlaceholders(t[k]); err != nil {
+				return nil, err
+			}
+		}
+
+	}
+
+	return v, nil
+}
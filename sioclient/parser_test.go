@@ -0,0 +1,246 @@
+package sioclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func raw(in ...string) []json.RawMessage {
+	out := make([]json.RawMessage, len(in))
+	for i := range in {
+		out[i] = json.RawMessage(in[i])
+	}
+	return out
+}
+
+func TestDecodePacket(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		packet      string
+		expected    Message
+		attachments int
+		// reencode is false for packets whose encoding is not canonical
+		reencode bool
+	}{
+		{
+			name:     "connect",
+			packet:   `0`,
+			expected: Message{Type: MessageTypeConnect, Namespace: "/"},
+			reencode: true,
+		},
+		{
+			name:     "connect namespace",
+			packet:   `0/admin,`,
+			expected: Message{Type: MessageTypeConnect, Namespace: "/admin"},
+		},
+		{
+			name:     "connect namespace without comma",
+			packet:   `0/admin`,
+			expected: Message{Type: MessageTypeConnect, Namespace: "/admin"},
+			reencode: true,
+		},
+		{
+			name:     "connect v4 with auth",
+			packet:   `0/admin,{"token":"123"}`,
+			expected: Message{Type: MessageTypeConnect, Namespace: "/admin", Payload: raw(`{"token":"123"}`)},
+			reencode: true,
+		},
+		{
+			name:     "connect v4 response",
+			packet:   `0{"sid":"oSO0OpakMV_3jnilAAAA"}`,
+			expected: Message{Type: MessageTypeConnect, Namespace: "/", Payload: raw(`{"sid":"oSO0OpakMV_3jnilAAAA"}`)},
+			reencode: true,
+		},
+		{
+			name:     "disconnect namespace",
+			packet:   `1/admin`,
+			expected: Message{Type: MessageTypeDisconnect, Namespace: "/admin"},
+			reencode: true,
+		},
+		{
+			name:     "event",
+			packet:   `2["auth:start",4711]`,
+			expected: Message{Type: MessageTypeEvent, Namespace: "/", Payload: raw(`"auth:start"`, `4711`)},
+			reencode: true,
+		},
+		{
+			name:     "event with single digit ID",
+			packet:   `21["hello"]`,
+			expected: Message{Type: MessageTypeEvent, Namespace: "/", ID: 1, Payload: raw(`"hello"`)},
+			reencode: true,
+		},
+		{
+			name:     "event with multi digit ID",
+			packet:   `2123["hello",{"a":1}]`,
+			expected: Message{Type: MessageTypeEvent, Namespace: "/", ID: 123, Payload: raw(`"hello"`, `{"a":1}`)},
+			reencode: true,
+		},
+		{
+			name:     "event in namespace",
+			packet:   `2/chat,["msg","hi"]`,
+			expected: Message{Type: MessageTypeEvent, Namespace: "/chat", Payload: raw(`"msg"`, `"hi"`)},
+			reencode: true,
+		},
+		{
+			name:     "event in namespace with ID",
+			packet:   `2/chat,456["msg","hi"]`,
+			expected: Message{Type: MessageTypeEvent, Namespace: "/chat", ID: 456, Payload: raw(`"msg"`, `"hi"`)},
+			reencode: true,
+		},
+		{
+			name:     "ack",
+			packet:   `312["ok"]`,
+			expected: Message{Type: MessageTypeAck, Namespace: "/", ID: 12, Payload: raw(`"ok"`)},
+			reencode: true,
+		},
+		{
+			name:     "ack without arguments in namespace",
+			packet:   `3/chat,23[]`,
+			expected: Message{Type: MessageTypeAck, Namespace: "/chat", ID: 23, Payload: raw()},
+			reencode: true,
+		},
+		{
+			name:     "error v3",
+			packet:   `4"Invalid namespace"`,
+			expected: Message{Type: MessageTypeError, Namespace: "/", Payload: raw(`"Invalid namespace"`)},
+			reencode: true,
+		},
+		{
+			name:     "connect error v4",
+			packet:   `4/admin,{"message":"Not authorized"}`,
+			expected: Message{Type: MessageTypeError, Namespace: "/admin", Payload: raw(`{"message":"Not authorized"}`)},
+			reencode: true,
+		},
+		{
+			name:        "binary event",
+			packet:      `51-["upload",{"_placeholder":true,"num":0}]`,
+			expected:    Message{Type: MessageTypeBinaryEvent, Namespace: "/", Payload: raw(`"upload"`, `{"_placeholder":true,"num":0}`)},
+			attachments: 1,
+		},
+		{
+			name:        "binary event in namespace with ID",
+			packet:      `52-/files,7["two",{"_placeholder":true,"num":0},{"_placeholder":true,"num":1}]`,
+			expected:    Message{Type: MessageTypeBinaryEvent, Namespace: "/files", ID: 7, Payload: raw(`"two"`, `{"_placeholder":true,"num":0}`, `{"_placeholder":true,"num":1}`)},
+			attachments: 2,
+		},
+		{
+			name:        "binary ack",
+			packet:      `61-3[{"_placeholder":true,"num":0}]`,
+			expected:    Message{Type: MessageTypeBinaryAck, Namespace: "/", ID: 3, Payload: raw(`{"_placeholder":true,"num":0}`)},
+			attachments: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, attachments, err := decodePacket([]byte(tc.packet))
+			if err != nil {
+				t.Fatalf("Unable to decode packet: %s", err)
+			}
+
+			if !reflect.DeepEqual(*m, tc.expected) {
+				t.Errorf("Unexpected message: %#v", *m)
+			}
+
+			if attachments != tc.attachments {
+				t.Errorf("Expected %d attachments, got %d", tc.attachments, attachments)
+			}
+
+			if !tc.reencode {
+				return
+			}
+
+			enc, err := m.Encode()
+			if err != nil {
+				t.Fatalf("Unable to encode message: %s", err)
+			}
+			if enc != tc.packet {
+				t.Errorf("Re-encoded packet differs: %s", enc)
+			}
+		})
+	}
+}
+
+func TestDecodePacketErrors(t *testing.T) {
+	for _, packet := range []string{
+		``,
+		`x`,
+		`7`,
+		`2`,
+		`2{"a":1}`,
+		`2[1,2]`,
+		`2["unterminated"`,
+		`1["not allowed"]`,
+		`5["no attachments"]`,
+		`5x-["invalid attachments"]`,
+	} {
+		if _, _, err := decodePacket([]byte(packet)); err == nil {
+			t.Errorf("Expected error for packet %q", packet)
+		}
+	}
+}
+
+func TestDecoderBinary(t *testing.T) {
+	var d Decoder
+
+	m, err := d.DecodeText([]byte(`52-/files,7["upload",{"name":"a","data":{"_placeholder":true,"num":0}},{"_placeholder":true,"num":1}]`))
+	if err != nil || m != nil {
+		t.Fatalf("Expected decoder to wait for attachments: %v / %v", m, err)
+	}
+
+	if m, err = d.DecodeBinary([]byte{1, 2, 3}); err != nil || m != nil {
+		t.Fatalf("Expected decoder to wait for second attachment: %v / %v", m, err)
+	}
+
+	if m, err = d.DecodeBinary([]byte("hello")); err != nil || m == nil {
+		t.Fatalf("Expected complete message: %v / %v", m, err)
+	}
+
+	var (
+		file struct {
+			Name string `json:"name"`
+			Data []byte `json:"data"`
+		}
+		second []byte
+	)
+
+	if err = json.Unmarshal(m.Payload[1], &file); err != nil {
+		t.Fatalf("Unable to unmarshal first argument: %s", err)
+	}
+	if err = json.Unmarshal(m.Payload[2], &second); err != nil {
+		t.Fatalf("Unable to unmarshal second argument: %s", err)
+	}
+
+	if file.Name != "a" || !reflect.DeepEqual(file.Data, []byte{1, 2, 3}) || string(second) != "hello" {
+		t.Errorf("Unexpected reconstituted payload: %+v / %q", file, second)
+	}
+
+	if _, err = d.DecodeBinary([]byte("unexpected")); err == nil {
+		t.Error("Expected error for attachment without pending message")
+	}
+
+	if _, err = d.DecodeText([]byte(`51-["upload",{"_placeholder":true,"num":1}]`)); err != nil {
+		t.Fatalf("Unable to decode packet: %s", err)
+	}
+	if _, err = d.DecodeBinary([]byte("data")); err == nil {
+		t.Error("Expected error for placeholder referencing missing attachment")
+	}
+}
+
+func TestEncodeBinary(t *testing.T) {
+	m := Message{
+		Type:        MessageTypeEvent,
+		Namespace:   "/files",
+		ID:          7,
+		Payload:     []json.RawMessage{json.RawMessage(`"upload"`), Placeholder(0)},
+		Attachments: [][]byte{{1, 2, 3}},
+	}
+
+	enc, err := m.Encode()
+	if err != nil {
+		t.Fatalf("Unable to encode message: %s", err)
+	}
+
+	if expected := `51-/files,7["upload",{"_placeholder":true,"num":0}]`; enc != expected {
+		t.Errorf("Unexpected encoding: %s", enc)
+	}
+}
@@ -0,0 +1,287 @@
+package sioclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// payloadSeparator delimits packets within a payload since EIO v4
+const payloadSeparator = '\x1e'
+
+type pollingTransport struct {
+	client  *http.Client
+	header  http.Header
+	url     *url.URL
+	version int
+
+	buffer []eioPacket
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	writeLock sync.Mutex
+}
+
+// openPolling executes the handshake request and returns a transport
+// bound to the new session. The handshake packets stay buffered. The
+// context only bounds the handshake, the transport lives until closed.
+func (e *EIOClient) openPolling(dialCtx context.Context) (*pollingTransport, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := &pollingTransport{
+		client:  e.httpClient,
+		header:  e.cfg.Header,
+		url:     e.transportURL(TransportPolling, ""),
+		version: e.cfg.Version,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	if e.cfg.HandshakeTimeout > 0 {
+		var cancelDial context.CancelFunc
+		dialCtx, cancelDial = context.WithTimeout(dialCtx, e.cfg.HandshakeTimeout)
+		defer cancelDial()
+	}
+
+	packets, err := p.poll(dialCtx)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "Unable to execute handshake")
+	}
+
+	if len(packets) == 0 || packets[0].Type != EIOMessageTypeOpen {
+		cancel()
+		return nil, errors.New("Handshake did not start with open packet")
+	}
+
+	var handshake eioSessionStart
+	if err = json.Unmarshal(packets[0].Data, &handshake); err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "Unable to unmarshal handshake")
+	}
+
+	p.url = e.transportURL(TransportPolling, handshake.SID)
+	p.buffer = packets
+
+	return p, nil
+}
+
+func (p *pollingTransport) Close() error {
+	p.cancel()
+	return nil
+}
+
+func (p *pollingTransport) Name() string { return TransportPolling }
+
+func (p *pollingTransport) Read() (eioPacket, error) {
+	for len(p.buffer) == 0 {
+		packets, err := p.poll(p.ctx)
+		if err != nil {
+			return eioPacket{}, err
+		}
+		p.buffer = packets
+	}
+
+	pkt := p.buffer[0]
+	p.buffer = p.buffer[1:]
+	return pkt, nil
+}
+
+func (p *pollingTransport) Write(pkt eioPacket) error {
+	// The server rejects overlapping POST requests
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodPost, p.requestURL(), bytes.NewReader(encodePayload([]eioPacket{pkt}, p.version)))
+	if err != nil {
+		return errors.Wrap(err, "Unable to create request")
+	}
+	req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+
+	_, err = p.do(req)
+	return err
+}
+
+func (p *pollingTransport) do(req *http.Request) ([]byte, error) {
+	for k, v := range p.header {
+		req.Header[k] = v
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read response")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Unexpected HTTP status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return body, nil
+}
+
+// drain removes and returns all packets fetched but not yet read
+func (p *pollingTransport) drain() []eioPacket {
+	packets := p.buffer
+	p.buffer = nil
+	return packets
+}
+
+func (p *pollingTransport) poll(ctx context.Context) ([]eioPacket, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.requestURL(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create request")
+	}
+
+	body, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePayload(body, p.version)
+}
+
+// requestURL adds a cache-buster to prevent proxies from answering
+// polling requests from their cache
+func (p *pollingTransport) requestURL() string {
+	u := *p.url
+
+	qVars := u.Query()
+	qVars.Set("t", strconv.FormatInt(time.Now().UnixNano(), 36))
+	u.RawQuery = qVars.Encode()
+
+	return u.String()
+}
+
+// decodePayload splits a polling payload into its packets. EIO v3 uses
+// length-prefixed packets ("<length>:<packet>", length counted in
+// UTF-16 code units), EIO v4 separates packets using the record
+// separator. Binary packets are base64 encoded and prefixed with "b".
+func decodePayload(data []byte, version int) ([]eioPacket, error) {
+	var packets []eioPacket
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if version >= EIOVersion4 {
+		for _, raw := range bytes.Split(data, []byte{payloadSeparator}) {
+			p, err := decodePayloadPacket(raw, version)
+			if err != nil {
+				return nil, err
+			}
+			packets = append(packets, p)
+		}
+		return packets, nil
+	}
+
+	for len(data) > 0 {
+		sep := bytes.IndexByte(data, ':')
+		if sep < 1 {
+			return nil, errors.New("Payload is missing packet length")
+		}
+
+		length, err := strconv.Atoi(string(data[:sep]))
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to parse packet length")
+		}
+		data = data[sep+1:]
+
+		// Length is given in UTF-16 code units so we need to walk the runes
+		var end, units int
+		for units < length {
+			if end >= len(data) {
+				return nil, errors.New("Payload is shorter than announced")
+			}
+			r, size := utf8.DecodeRune(data[end:])
+			end += size
+			units += len(utf16.Encode([]rune{r}))
+		}
+
+		p, err := decodePayloadPacket(data[:end], version)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, p)
+		data = data[end:]
+	}
+
+	return packets, nil
+}
+
+func decodePayloadPacket(raw []byte, version int) (eioPacket, error) {
+	if len(raw) == 0 || raw[0] != 'b' {
+		return decodeTextPacket(raw)
+	}
+
+	raw = raw[1:]
+	pType := EIOMessageTypeMessage
+
+	if version == EIOVersion3 {
+		if len(raw) == 0 {
+			return eioPacket{}, errors.New("Binary packet is missing type")
+		}
+
+		v, err := strconv.Atoi(string(raw[0]))
+		if err != nil {
+			return eioPacket{}, errors.Wrap(err, "Unable to parse message type")
+		}
+		pType = EIOMessageType(v)
+		raw = raw[1:]
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(raw))
+	if err != nil {
+		return eioPacket{}, errors.Wrap(err, "Unable to decode binary packet")
+	}
+
+	return eioPacket{Type: pType, Data: data, Binary: true}, nil
+}
+
+func encodePayload(packets []eioPacket, version int) []byte {
+	var buf = new(bytes.Buffer)
+
+	for i, p := range packets {
+		var enc string
+
+		switch {
+		case !p.Binary:
+			enc = strconv.Itoa(int(p.Type)) + string(p.Data)
+		case version == EIOVersion3:
+			enc = "b" + strconv.Itoa(int(p.Type)) + base64.StdEncoding.EncodeToString(p.Data)
+		default:
+			enc = "b" + base64.StdEncoding.EncodeToString(p.Data)
+		}
+
+		if version >= EIOVersion4 {
+			if i > 0 {
+				buf.WriteByte(payloadSeparator)
+			}
+			buf.WriteString(enc)
+			continue
+		}
+
+		buf.WriteString(strconv.Itoa(len(utf16.Encode([]rune(enc)))))
+		buf.WriteByte(':')
+		buf.WriteString(enc)
+	}
+
+	return buf.Bytes()
+}
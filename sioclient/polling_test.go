@@ -0,0 +1,86 @@
+package sioclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPayloadCodec(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		version int
+		payload string
+		packets []eioPacket
+	}{
+		{
+			name:    "v3 single packet",
+			version: EIOVersion3,
+			payload: `2:40`,
+			packets: []eioPacket{{Type: EIOMessageTypeMessage, Data: []byte("0")}},
+		},
+		{
+			name:    "v3 multiple packets",
+			version: EIOVersion3,
+			payload: `6:2probe13:42["hello",1]1:6`,
+			packets: []eioPacket{
+				{Type: EIOMessageTypePing, Data: []byte("probe")},
+				{Type: EIOMessageTypeMessage, Data: []byte(`2["hello",1]`)},
+				{Type: EIOMessageTypeNoop, Data: []byte{}},
+			},
+		},
+		{
+			name:    "v3 length in UTF-16 code units",
+			version: EIOVersion3,
+			// "€" is a single code unit, "😀" needs a surrogate pair
+			payload: `12:42["€","😀"]2:40`,
+			packets: []eioPacket{
+				{Type: EIOMessageTypeMessage, Data: []byte(`2["€","😀"]`)},
+				{Type: EIOMessageTypeMessage, Data: []byte("0")},
+			},
+		},
+		{
+			name:    "v3 binary",
+			version: EIOVersion3,
+			payload: `6:b4AQID`,
+			packets: []eioPacket{{Type: EIOMessageTypeMessage, Data: []byte{1, 2, 3}, Binary: true}},
+		},
+		{
+			name:    "v4 multiple packets",
+			version: EIOVersion4,
+			payload: "2\x1e42[\"hello\",1]\x1ebAQID",
+			packets: []eioPacket{
+				{Type: EIOMessageTypePing, Data: []byte{}},
+				{Type: EIOMessageTypeMessage, Data: []byte(`2["hello",1]`)},
+				{Type: EIOMessageTypeMessage, Data: []byte{1, 2, 3}, Binary: true},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			packets, err := decodePayload([]byte(tc.payload), tc.version)
+			if err != nil {
+				t.Fatalf("Unable to decode payload: %s", err)
+			}
+
+			if !reflect.DeepEqual(packets, tc.packets) {
+				t.Errorf("Unexpected packets decoded: %#v", packets)
+			}
+
+			if enc := string(encodePayload(tc.packets, tc.version)); enc != tc.payload {
+				t.Errorf("Unexpected payload encoded: %q", enc)
+			}
+		})
+	}
+}
+
+func TestPayloadDecodeErrors(t *testing.T) {
+	for _, payload := range []string{
+		`5:40`,
+		`x:40`,
+		`40`,
+		`3:b4!`,
+	} {
+		if _, err := decodePayload([]byte(payload), EIOVersion3); err == nil {
+			t.Errorf("Expected error for payload %q", payload)
+		}
+	}
+}
@@ -2,8 +2,13 @@ package sioclient
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -21,27 +26,79 @@ const (
 )
 
 type Config struct {
-	MessageHandler func(*Message) error
-	URL            string
+	// Auth is sent as payload of the CONNECT packet (EIO v4 only)
+	Auth             interface{}
+	EIOVersion       int
+	HandshakeTimeout time.Duration
+	Header           http.Header
+	Jar              http.CookieJar
+	MessageHandler   func(*Message) error
+	Proxy            *url.URL
+	Reconnect        ReconnectConfig
+	StateHandler     func(ConnectionState)
+	TLSConfig        *tls.Config
+	Transport        string
+	Upgrade          bool
+	URL              string
 }
 
 type Client struct {
 	EIO *EIOClient
 
-	cfg Config
+	cfg        Config
+	decoder    Decoder
+	namespaces namespaceRegistry
 }
 
+// New creates a client and connects it to the server. To register
+// handlers before the first event is received use NewClient and Dial.
 func New(c Config) (*Client, error) {
+	client, err := NewClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, client.Dial()
+}
+
+// NewWithContext creates a client and connects it to the server. The
+// client is closed when the context is cancelled.
+func NewWithContext(ctx context.Context, c Config) (*Client, error) {
+	client, err := NewClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, client.DialContext(ctx)
+}
+
+// NewClient creates a client without connecting it to the server
+func NewClient(c Config) (*Client, error) {
 	var (
 		client = new(Client)
 		err    error
 	)
 
 	client.cfg = c
+	client.namespaces.namespaces = map[string]*Namespace{
+		defaultNamespace: {client: client, name: defaultNamespace},
+	}
 
-	if client.EIO, err = NewEIOClient(EIOClientConfig{
-		MessageHandlerText: client.handleTextMessage,
-		URL:                c.URL,
+	if client.EIO, err = newEIOClient(EIOClientConfig{
+		HandshakeTimeout:     c.HandshakeTimeout,
+		Header:               c.Header,
+		Jar:                  c.Jar,
+		MessageHandlerBinary: client.handleBinaryMessage,
+		MessageHandlerText:   client.handleTextMessage,
+		OpenHandler:          client.handleOpen,
+		Proxy:                c.Proxy,
+		Reconnect:            c.Reconnect,
+		StateHandler:         c.StateHandler,
+		TLSConfig:            c.TLSConfig,
+		Transport:            c.Transport,
+		Upgrade:              c.Upgrade,
+		URL:                  c.URL,
+		Version:              c.EIOVersion,
 	}); err != nil {
 		return nil, errors.Wrap(err, "Unable to create EIO client")
 	}
@@ -49,16 +106,64 @@ func New(c Config) (*Client, error) {
 	return client, nil
 }
 
-func (c Client) Close() error {
+func (c *Client) Close() error {
 	return c.EIO.Close()
 }
 
-func (c Client) handleTextMessage(msg []byte) error {
-	m, err := c.parseProto(msg)
+// Dial connects the client to the server
+func (c *Client) Dial() error { return c.DialContext(context.Background()) }
+
+// DialContext connects the client to the server. The context bounds the
+// dial and the lifetime of the connection: when it is cancelled the
+// client is closed.
+func (c *Client) DialContext(ctx context.Context) error {
+	return errors.Wrap(c.EIO.connect(ctx), "Unable to connect EIO client")
+}
+
+// Done returns a channel closed after the client was closed and its
+// goroutines have stopped
+func (c *Client) Done() <-chan struct{} { return c.EIO.Done() }
+
+func (c *Client) handleBinaryMessage(msg []byte) error {
+	m, err := c.decoder.DecodeBinary(msg)
 	if err != nil {
 		return errors.Wrap(err, "Unable to parse message")
 	}
 
+	return c.handleMessage(m)
+}
+
+func (c *Client) handleTextMessage(msg []byte) error {
+	m, err := c.decoder.DecodeText(msg)
+	if err != nil {
+		return errors.Wrap(err, "Unable to parse message")
+	}
+
+	return c.handleMessage(m)
+}
+
+func (c *Client) handleMessage(m *Message) error {
+	if m == nil {
+		// Waiting for binary attachments
+		return nil
+	}
+
+	if ns := c.namespace(m.Namespace); ns != nil {
+		handled, err := ns.handleMessage(m)
+		if err != nil {
+			return err
+		}
+
+		if handled && (m.Type == MessageTypeAck || m.Type == MessageTypeBinaryAck) {
+			// Acknowledgements are consumed by the emitter
+			return nil
+		}
+	}
+
+	if c.cfg.MessageHandler == nil {
+		return nil
+	}
+
 	return c.cfg.MessageHandler(m)
 }
 
@@ -67,6 +172,9 @@ type Message struct {
 	Namespace string
 	ID        int
 	Payload   []json.RawMessage
+	// Attachments contains the binary data of binary messages, the
+	// payload references them using Placeholder
+	Attachments [][]byte
 }
 
 func NewMessage(sType MessageType, id int, payloadType string, data interface{}) (*Message, error) {
@@ -90,17 +198,61 @@ func NewMessage(sType MessageType, id int, payloadType string, data interface{})
 	return out, nil
 }
 
+// Encode returns the text packet of the message. Events and acks
+// having attachments are encoded as their binary counterparts, the
+// attachments need to be sent as binary packets afterwards.
 func (m Message) Encode() (string, error) {
-	data, err := json.Marshal(m.Payload)
-	if err != nil {
-		return "", errors.Wrap(err, "Unable to marshal payload")
+	var (
+		data  []byte
+		err   error
+		mType = m.Type
+	)
+
+	switch mType {
+
+	case MessageTypeConnect, MessageTypeError:
+		if len(m.Payload) > 1 {
+			return "", errors.New("Message type supports only one payload element")
+		}
+		if len(m.Payload) == 1 {
+			data = m.Payload[0]
+		}
+
+	case MessageTypeDisconnect:
+		if len(m.Payload) > 0 {
+			return "", errors.New("Disconnect must not carry a payload")
+		}
+
+	default:
+		if data, err = json.Marshal(m.Payload); err != nil {
+			return "", errors.Wrap(err, "Unable to marshal payload")
+		}
+
+		switch {
+		case len(m.Attachments) > 0 && mType == MessageTypeEvent:
+			mType = MessageTypeBinaryEvent
+		case len(m.Attachments) > 0 && mType == MessageTypeAck:
+			mType = MessageTypeBinaryAck
+		case len(m.Attachments) == 0 && mType == MessageTypeBinaryEvent:
+			mType = MessageTypeEvent
+		case len(m.Attachments) == 0 && mType == MessageTypeBinaryAck:
+			mType = MessageTypeAck
+		}
+
 	}
 
 	var msg = new(bytes.Buffer)
-	msg.WriteString(strconv.Itoa(int(m.Type)))
+	msg.WriteString(strconv.Itoa(int(mType)))
+
+	if mType == MessageTypeBinaryEvent || mType == MessageTypeBinaryAck {
+		msg.WriteString(strconv.Itoa(len(m.Attachments)) + "-")
+	}
 
 	if m.Namespace != "" && m.Namespace != "/" {
-		msg.WriteString(m.Namespace + ",")
+		msg.WriteString(m.Namespace)
+		if m.ID > 0 || len(data) > 0 {
+			msg.WriteString(",")
+		}
 	}
 
 	if m.ID > 0 {
@@ -128,54 +280,17 @@ func (m Message) Send(c *Client) error {
 		return errors.Wrap(err, "Unable to encode message")
 	}
 
-	return c.EIO.SendTextMessage(EIOMessageTypeMessage, raw)
-}
-
-func (m Message) UnmarshalPayload(out interface{}) error { return json.Unmarshal(m.Payload[1], out) }
-
-func (c Client) parseProto(msg []byte) (*Message, error) {
-	var (
-		err    error
-		outMsg = new(Message)
-		ptr    int
-	)
-
-	if len(msg) < 1 {
-		return nil, errors.New("Message was empty")
-	}
-
-	// Get message type
-	mType, err := strconv.Atoi(string(msg[ptr]))
-	if err != nil {
-		return nil, errors.Wrap(err, "Unable to parse message type")
-	}
-	outMsg.Type = MessageType(mType)
-	ptr++
-
-	// Message contains only message type
-	if len(msg[ptr:]) == 0 {
-		return outMsg, nil
-	}
-
-	// Binary
-	if outMsg.Type == MessageTypeBinaryEvent || outMsg.Type == MessageTypeBinaryAck {
-		return nil, errors.New("Binary is not supported")
-	}
-
-	// Check for namespace
-	if msg[ptr] == '/' {
-		return nil, errors.New("Namespaces is not supported")
+	if err = c.EIO.SendTextMessage(EIOMessageTypeMessage, raw); err != nil {
+		return err
 	}
 
-	// Read message ID if any
-	if outMsg.ID, err = strconv.Atoi(string(msg[ptr])); err == nil {
-		ptr++
+	for i, a := range m.Attachments {
+		if err = c.EIO.SendBinaryMessage(a); err != nil {
+			return errors.Wrapf(err, "Unable to send attachment %d", i)
+		}
 	}
 
-	// If there is no more data we have an empty message
-	if len(msg[ptr:]) == 0 || outMsg.Type == MessageTypeConnect {
-		return outMsg, nil
-	}
-
-	return outMsg, errors.Wrap(json.Unmarshal(msg[ptr:], &outMsg.Payload), "Unable to unmarshal message")
+	return nil
 }
+
+func (m Message) UnmarshalPayload(out interface{}) error { return json.Unmarshal(m.Payload[1], out) }
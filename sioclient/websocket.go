@@ -0,0 +1,107 @@
+package sioclient
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+type websocketTransport struct {
+	conn    *websocket.Conn
+	version int
+
+	// pending holds packets received by the previous transport before
+	// the connection was upgraded, they are returned before reading
+	// from the websocket
+	pending []eioPacket
+
+	writeLock sync.Mutex
+}
+
+func (e *EIOClient) dialWebsocket(ctx context.Context, sid string) (*websocketTransport, error) {
+	conn, _, err := e.dialer.DialContext(ctx, e.transportURL(TransportWebsocket, sid).String(), e.cfg.Header)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to dial websocket")
+	}
+
+	return &websocketTransport{conn: conn, version: e.cfg.Version}, nil
+}
+
+func (w *websocketTransport) Close() error { return w.conn.Close() }
+
+func (w *websocketTransport) Name() string { return TransportWebsocket }
+
+func (w *websocketTransport) Read() (eioPacket, error) {
+	if len(w.pending) > 0 {
+		p := w.pending[0]
+		w.pending = w.pending[1:]
+		return p, nil
+	}
+
+	messageType, message, err := w.conn.ReadMessage()
+	if err != nil {
+		return eioPacket{}, err
+	}
+
+	if messageType == websocket.TextMessage {
+		return decodeTextPacket(message)
+	}
+
+	if w.version == EIOVersion3 {
+		if len(message) < 1 {
+			return eioPacket{}, errors.New("Empty message received")
+		}
+		return eioPacket{Type: EIOMessageType(message[0]), Data: message[1:], Binary: true}, nil
+	}
+
+	// Starting with EIO v4 binary frames are not prefixed with the
+	// message type as they can only contain messages
+	return eioPacket{Type: EIOMessageTypeMessage, Data: message, Binary: true}, nil
+}
+
+func (w *websocketTransport) Write(p eioPacket) error {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	if !p.Binary {
+		return w.conn.WriteMessage(websocket.TextMessage, append([]byte(strconv.Itoa(int(p.Type))), p.Data...))
+	}
+
+	if w.version == EIOVersion3 {
+		return w.conn.WriteMessage(websocket.BinaryMessage, append([]byte{byte(p.Type)}, p.Data...))
+	}
+
+	return w.conn.WriteMessage(websocket.BinaryMessage, p.Data)
+}
+
+// probe executes the upgrade handshake on the websocket: the server
+// must answer a probe ping before the client confirms the upgrade
+func (w *websocketTransport) probe() error {
+	if err := w.Write(eioPacket{Type: EIOMessageTypePing, Data: []byte("probe")}); err != nil {
+		return errors.Wrap(err, "Unable to send probe")
+	}
+
+	if err := w.conn.SetReadDeadline(time.Now().Add(upgradeProbeTimeout)); err != nil {
+		return errors.Wrap(err, "Unable to set read deadline")
+	}
+
+	p, err := w.Read()
+	if err != nil {
+		return errors.Wrap(err, "Unable to read probe response")
+	}
+
+	if p.Type != EIOMessageTypePong || !bytes.Equal(p.Data, []byte("probe")) {
+		return errors.New("Invalid probe response")
+	}
+
+	if err = w.conn.SetReadDeadline(time.Time{}); err != nil {
+		return errors.Wrap(err, "Unable to reset read deadline")
+	}
+
+	return errors.Wrap(w.Write(eioPacket{Type: EIOMessageTypeUpgrade}), "Unable to send upgrade")
+}
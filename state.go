@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// appState is persisted between runs to reuse the session of the user
+// instead of logging in using the password every time
+type appState struct {
+	// Tokens maps "<user>@<socket-url>" to the session token
+	Tokens map[string]string `json:"tokens"`
+	// TwitchTokens maps the Twitch client ID to the user access token
+	TwitchTokens map[string]twitchToken `json:"twitch_tokens,omitempty"`
+
+	filename string
+}
+
+func loadState() (*appState, error) {
+	s := &appState{
+		filename:     cfg.StateFile,
+		Tokens:       map[string]string{},
+		TwitchTokens: map[string]twitchToken{},
+	}
+
+	if s.filename == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to determine config directory")
+		}
+		s.filename = filepath.Join(dir, "lounge-control", "state.json")
+	}
+
+	raw, err := ioutil.ReadFile(s.filename)
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "Unable to read state file")
+	}
+
+	if err = json.Unmarshal(raw, s); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse state file")
+	}
+
+	if s.Tokens == nil {
+		s.Tokens = map[string]string{}
+	}
+	if s.TwitchTokens == nil {
+		s.TwitchTokens = map[string]twitchToken{}
+	}
+
+	return s, nil
+}
+
+// Token returns the stored session token for the configured user
+func (a *appState) Token() string { return a.Tokens[a.key()] }
+
+// SetToken stores the token for the configured user and persists the
+// state, an empty token removes the session
+func (a *appState) SetToken(token string) error {
+	if token == "" {
+		delete(a.Tokens, a.key())
+	} else {
+		a.Tokens[a.key()] = token
+	}
+
+	return a.save()
+}
+
+// TwitchToken returns the cached Twitch token for the given key
+func (a *appState) TwitchToken(key string) twitchToken { return a.TwitchTokens[key] }
+
+// SetTwitchToken stores the Twitch token and persists the state, an
+// empty token removes it
+func (a *appState) SetTwitchToken(key string, token twitchToken) error {
+	if token.AccessToken == "" {
+		delete(a.TwitchTokens, key)
+	} else {
+		a.TwitchTokens[key] = token
+	}
+
+	return a.save()
+}
+
+func (a *appState) key() string { return cfg.Username + "@" + cfg.SocketURL }
+
+func (a *appState) save() error {
+	// The tokens grant full access to the account of the user
+	if err := os.MkdirAll(filepath.Dir(a.filename), 0700); err != nil {
+		return errors.Wrap(err, "Unable to create state directory")
+	}
+
+	raw, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Unable to marshal state")
+	}
+
+	tmp := a.filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return errors.Wrap(err, "Unable to write state file")
+	}
+
+	// WriteFile does not touch the permissions of existing files
+	if err = os.Chmod(tmp, 0600); err != nil {
+		return errors.Wrap(err, "Unable to set state file permissions")
+	}
+
+	return errors.Wrap(os.Rename(tmp, a.filename), "Unable to replace state file")
+}
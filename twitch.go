@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// twitchScopes are requested for user access tokens
+	twitchScopes = "user:read:follows"
+
+	// twitchTokenExpiryMargin is subtracted from the lifetime of tokens
+	// to not use them while they are about to expire
+	twitchTokenExpiryMargin = time.Minute
+)
+
+var (
+	twitchAPIBaseURL  = "https://api.twitch.tv/helix"
+	twitchAuthBaseURL = "https://id.twitch.tv/oauth2"
+)
+
+// twitchToken is an access token of the Twitch API cached in the state
+type twitchToken struct {
+	AccessToken  string    `json:"access_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+}
+
+func (t twitchToken) valid() bool {
+	return t.AccessToken != "" && time.Now().Add(twitchTokenExpiryMargin).Before(t.ExpiresAt)
+}
+
+// twitchTokenError is returned by the token endpoint for failed
+// requests, i.e. while the user did not yet authorize the device
+type twitchTokenError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (t twitchTokenError) Error() string {
+	return fmt.Sprintf("Twitch token request failed (%d): %s", t.Status, t.Message)
+}
+
+// twitchClient executes requests against the Helix API using a user
+// access token requested by the device-code flow. App access tokens
+// are not supported as Twitch lists the followed channels only to the
+// user themselves.
+type twitchClient struct {
+	clientID     string
+	clientSecret string
+	token        twitchToken
+}
+
+// newTwitchClient validates the Twitch options and authorizes the
+// client, reusing the cached token if still valid or refreshable
+func newTwitchClient() (*twitchClient, error) {
+	t := &twitchClient{
+		clientID:     cfg.TwitchClientID,
+		clientSecret: cfg.TwitchClientSecret,
+	}
+
+	if t.clientID == "" {
+		return nil, usageErrorf("No Twitch client ID given, register an application at https://dev.twitch.tv/console")
+	}
+
+	return t, t.authorize()
+}
+
+// authorize ensures a valid token is available and stores new tokens
+// in the state
+func (t *twitchClient) authorize() error {
+	t.token = state.TwitchToken(t.cacheKey())
+	if t.token.valid() {
+		return nil
+	}
+
+	if t.token.RefreshToken != "" {
+		log.Debug("Refreshing Twitch access token")
+		token, err := t.requestToken(url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {t.token.RefreshToken},
+		})
+		if err == nil {
+			t.token = token
+			return errors.Wrap(state.SetTwitchToken(t.cacheKey(), t.token), "Unable to store Twitch token")
+		}
+
+		// Refresh tokens are invalidated when the user revokes access, so
+		// we need to start over
+		log.WithError(err).Warn("Unable to refresh Twitch access token")
+	}
+
+	token, err := t.deviceCode()
+	if err != nil {
+		return errors.Wrap(err, "Unable to authorize at Twitch")
+	}
+
+	t.token = token
+	return errors.Wrap(state.SetTwitchToken(t.cacheKey(), t.token), "Unable to store Twitch token")
+}
+
+func (t *twitchClient) cacheKey() string { return t.clientID }
+
+// deviceCode asks the user to authorize the device in the browser and
+// polls for the user access token until the code expires
+func (t *twitchClient) deviceCode() (twitchToken, error) {
+	var device struct {
+		DeviceCode      string `json:"device_code"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+		UserCode        string `json:"user_code"`
+		VerificationURI string `json:"verification_uri"`
+	}
+
+	resp, err := httpClient().PostForm(twitchAuthBaseURL+"/device", url.Values{
+		"client_id": {t.clientID},
+		"scopes":    {twitchScopes},
+	})
+	if err != nil {
+		return twitchToken{}, errors.Wrap(err, "Unable to request device code")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return twitchToken{}, errors.Errorf("Unexpected status requesting device code: %s", resp.Status)
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&device); err != nil {
+		return twitchToken{}, errors.Wrap(err, "Unable to read device code response")
+	}
+
+	log.WithField("code", device.UserCode).Infof("Authorize lounge-control to read your follows at %s", device.VerificationURI)
+
+	var (
+		deadline = time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+		interval = time.Duration(device.Interval) * time.Second
+	)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		token, err := t.requestToken(url.Values{
+			"device_code": {device.DeviceCode},
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"scopes":      {twitchScopes},
+		})
+
+		if tErr, ok := errors.Cause(err).(twitchTokenError); ok {
+			switch tErr.Message {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+
+		return token, err
+	}
+
+	return twitchToken{}, errors.New("Device code expired before authorization")
+}
+
+// requestToken executes a request against the token endpoint adding
+// the client credentials to the given parameters
+func (t *twitchClient) requestToken(params url.Values) (twitchToken, error) {
+	params.Set("client_id", t.clientID)
+	if t.clientSecret != "" {
+		params.Set("client_secret", t.clientSecret)
+	}
+
+	resp, err := httpClient().PostForm(twitchAuthBaseURL+"/token", params)
+	if err != nil {
+		return twitchToken{}, errors.Wrap(err, "Unable to request token")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		tErr := twitchTokenError{Status: resp.StatusCode}
+		if err = json.NewDecoder(resp.Body).Decode(&tErr); err != nil || tErr.Message == "" {
+			tErr.Message = resp.Status
+		}
+		return twitchToken{}, tErr
+	}
+
+	var payload struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return twitchToken{}, errors.Wrap(err, "Unable to read token response")
+	}
+
+	return twitchToken{
+		AccessToken:  payload.AccessToken,
+		ExpiresAt:    time.Now().Add(time.Duration(payload.ExpiresIn) * time.Second),
+		RefreshToken: payload.RefreshToken,
+	}, nil
+}
+
+// get requests the Helix API path and decodes the response into out
+func (t *twitchClient) get(path string, params url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, twitchAPIBaseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return errors.Wrap(err, "Unable to create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token.AccessToken)
+	req.Header.Set("Client-Id", t.clientID)
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to request %s", path)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		// Token was revoked, the next run needs to authorize again
+		if err = state.SetTwitchToken(t.cacheKey(), twitchToken{}); err != nil {
+			return errors.Wrap(err, "Unable to remove rejected Twitch token")
+		}
+		return errors.Errorf("Twitch rejected the access token for %s, please retry to authorize again", path)
+	default:
+		return errors.Errorf("Unexpected status requesting %s: %s", path, resp.Status)
+	}
+
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(out), "Unable to read response of %s", path)
+}
+
+// userID resolves the login name of a Twitch user into its ID
+func (t *twitchClient) userID(login string) (string, error) {
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+
+	if err := t.get("/users", url.Values{"login": {strings.ToLower(login)}}, &resp); err != nil {
+		return "", err
+	}
+
+	if l := len(resp.Data); l != 1 {
+		return "", errors.Errorf("Received invalid number of user IDs: %d", l)
+	}
+
+	return resp.Data[0].ID, nil
+}
+
+// followedChannels returns the login names of all channels followed
+// by the user with the given ID
+func (t *twitchClient) followedChannels(userID string) ([]string, error) {
+	var (
+		channels []string
+		cursor   string
+	)
+
+	for {
+		var resp struct {
+			Data []struct {
+				BroadcasterLogin string `json:"broadcaster_login"`
+			} `json:"data"`
+			Pagination struct {
+				Cursor string `json:"cursor"`
+			} `json:"pagination"`
+		}
+
+		params := url.Values{"user_id": {userID}, "first": {"100"}}
+		if cursor != "" {
+			params.Set("after", cursor)
+		}
+
+		if err := t.get("/channels/followed", params, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, d := range resp.Data {
+			channels = append(channels, d.BroadcasterLogin)
+		}
+
+		if resp.Pagination.Cursor == "" || len(resp.Data) == 0 {
+			return channels, nil
+		}
+		cursor = resp.Pagination.Cursor
+	}
+}